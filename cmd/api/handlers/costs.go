@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"pluto-restore-assets/internal/s3utils"
+	"pluto-restore-assets/internal/types"
+	"sort"
+	"strings"
+)
+
+const (
+	// GET request costs per 1000 requests
+	GET_REQUEST_COST_PER_1000 = 0.0004 // $0.0004 per 1000 requests
+
+	// Data transfer cost
+	DATA_TRANSFER_COST_PER_GB = 0.09 // $0.09 per GB
+)
+
+type retrievalTier struct {
+	RequestCostPer1000 float64 // restore request cost per 1000 objects
+	RetrievalCostPerGB float64
+	Time               string
+	MaxHours           float64
+}
+
+type storageClassPricing struct {
+	Standard retrievalTier
+	Bulk     retrievalTier
+}
+
+var immediateRetrieval = retrievalTier{Time: "immediate", MaxHours: 0}
+
+// Pricing and retrieval times per storage class. Classes not listed here can be
+// downloaded straight away and only incur GET and transfer costs.
+var storageClassPricingTable = map[string]storageClassPricing{
+	"GLACIER": {
+		Standard: retrievalTier{RequestCostPer1000: 0.03, Time: "3-5 hours", MaxHours: 5},
+		Bulk:     retrievalTier{RequestCostPer1000: 0.025, Time: "5-12 hours", MaxHours: 12},
+	},
+	"DEEP_ARCHIVE": {
+		Standard: retrievalTier{RequestCostPer1000: 0.10, RetrievalCostPerGB: 0.02, Time: "up to 12 hours", MaxHours: 12},
+		Bulk:     retrievalTier{RequestCostPer1000: 0.025, RetrievalCostPerGB: 0.0025, Time: "up to 48 hours", MaxHours: 48},
+	},
+	// Instant Retrieval needs no restore but charges for data retrieval
+	"GLACIER_IR": {
+		Standard: retrievalTier{RetrievalCostPerGB: 0.03, Time: immediateRetrieval.Time},
+		Bulk:     retrievalTier{RetrievalCostPerGB: 0.03, Time: immediateRetrieval.Time},
+	},
+}
+
+func pricingFor(storageClass string) storageClassPricing {
+	if pricing, ok := storageClassPricingTable[storageClass]; ok {
+		return pricing
+	}
+	return storageClassPricing{Standard: immediateRetrieval, Bulk: immediateRetrieval}
+}
+
+func tierCost(tier retrievalTier, numberOfFiles float64, totalDataGB float64) float64 {
+	restoreRequestCost := (numberOfFiles * tier.RequestCostPer1000) / 1000
+	retrievalCost := totalDataGB * tier.RetrievalCostPerGB
+	getRequestCost := (numberOfFiles * GET_REQUEST_COST_PER_1000) / 1000
+	dataTransferCost := totalDataGB * DATA_TRANSFER_COST_PER_GB
+	return restoreRequestCost + retrievalCost + getRequestCost + dataTransferCost
+}
+
+// estimateRestore breaks the manifest down by storage class and returns the
+// per-class estimates together with the total Standard and Bulk costs.
+func estimateRestore(stats *s3utils.ManifestStats) (map[string]types.StorageClassEstimate, float64, float64) {
+	estimates := make(map[string]types.StorageClassEstimate, len(stats.StorageClasses))
+	var totalStandard, totalBulk float64
+
+	for storageClass, classStats := range stats.StorageClasses {
+		pricing := pricingFor(storageClass)
+		totalDataGB := float64(classStats.TotalSize) / (1024 * 1024 * 1024)
+
+		estimate := types.StorageClassEstimate{
+			FileCount:       int64(classStats.FileCount),
+			TotalSize:       totalDataGB,
+			RequiresRestore: s3utils.RequiresRestore(storageClass),
+			StandardCost:    tierCost(pricing.Standard, float64(classStats.FileCount), totalDataGB),
+			BulkCost:        tierCost(pricing.Bulk, float64(classStats.FileCount), totalDataGB),
+			StandardTime:    pricing.Standard.Time,
+			BulkTime:        pricing.Bulk.Time,
+			StandardHours:   pricing.Standard.MaxHours,
+			BulkHours:       pricing.Bulk.MaxHours,
+		}
+		estimates[storageClass] = estimate
+		totalStandard += estimate.StandardCost
+		totalBulk += estimate.BulkCost
+	}
+
+	return estimates, totalStandard, totalBulk
+}
+
+// slowestRetrieval returns the longest expected Standard and Bulk windows across
+// all storage classes, which is when the whole restore can be expected to finish.
+func slowestRetrieval(estimates map[string]types.StorageClassEstimate) (standard, bulk retrievalTier) {
+	standard, bulk = immediateRetrieval, immediateRetrieval
+	for _, estimate := range estimates {
+		if estimate.StandardHours > standard.MaxHours {
+			standard = retrievalTier{Time: estimate.StandardTime, MaxHours: estimate.StandardHours}
+		}
+		if estimate.BulkHours > bulk.MaxHours {
+			bulk = retrievalTier{Time: estimate.BulkTime, MaxHours: estimate.BulkHours}
+		}
+	}
+	return standard, bulk
+}
+
+func formatStorageClassBreakdown(estimates map[string]types.StorageClassEstimate) string {
+	classes := make([]string, 0, len(estimates))
+	for storageClass := range estimates {
+		classes = append(classes, storageClass)
+	}
+	sort.Strings(classes)
+
+	var b strings.Builder
+	for _, storageClass := range classes {
+		estimate := estimates[storageClass]
+		fmt.Fprintf(&b, "• %s: %d files, %.2f GB", storageClass, estimate.FileCount, estimate.TotalSize)
+		if estimate.RequiresRestore {
+			fmt.Fprintf(&b, " (Standard: %s, Bulk: %s)\n", estimate.StandardTime, estimate.BulkTime)
+		} else {
+			b.WriteString(" (no restore needed)\n")
+		}
+	}
+	return b.String()
+}
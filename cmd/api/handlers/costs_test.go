@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"testing"
+
+	"pluto-restore-assets/internal/s3utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateRestore(t *testing.T) {
+	const gb = 1024 * 1024 * 1024
+	stats := &s3utils.ManifestStats{
+		FileCount: 3000,
+		TotalSize: 300 * gb,
+		StorageClasses: map[string]*s3utils.StorageClassStats{
+			"GLACIER":      {FileCount: 1000, TotalSize: 100 * gb},
+			"DEEP_ARCHIVE": {FileCount: 1000, TotalSize: 100 * gb},
+			"GLACIER_IR":   {FileCount: 1000, TotalSize: 100 * gb},
+		},
+	}
+
+	estimates, standardCost, bulkCost := estimateRestore(stats)
+
+	glacier := estimates["GLACIER"]
+	assert.True(t, glacier.RequiresRestore)
+	assert.InDelta(t, 0.03+0.0004+9.0, glacier.StandardCost, 0.0001)
+	assert.InDelta(t, 0.025+0.0004+9.0, glacier.BulkCost, 0.0001)
+	assert.Equal(t, "3-5 hours", glacier.StandardTime)
+
+	deepArchive := estimates["DEEP_ARCHIVE"]
+	assert.True(t, deepArchive.RequiresRestore)
+	assert.InDelta(t, 0.10+2.0+0.0004+9.0, deepArchive.StandardCost, 0.0001)
+	assert.InDelta(t, 0.025+0.25+0.0004+9.0, deepArchive.BulkCost, 0.0001)
+	assert.Equal(t, "up to 48 hours", deepArchive.BulkTime)
+
+	instant := estimates["GLACIER_IR"]
+	assert.False(t, instant.RequiresRestore)
+	assert.Equal(t, "immediate", instant.StandardTime)
+
+	assert.InDelta(t, glacier.StandardCost+deepArchive.StandardCost+instant.StandardCost, standardCost, 0.0001)
+	assert.InDelta(t, glacier.BulkCost+deepArchive.BulkCost+instant.BulkCost, bulkCost, 0.0001)
+
+	// The restore finishes when the slowest class does
+	standardTime, bulkTime := slowestRetrieval(estimates)
+	assert.Equal(t, "up to 12 hours", standardTime.Time)
+	assert.Equal(t, "up to 48 hours", bulkTime.Time)
+}
+
+func TestSlowestRetrievalWithoutArchivedObjects(t *testing.T) {
+	estimates, _, _ := estimateRestore(&s3utils.ManifestStats{
+		StorageClasses: map[string]*s3utils.StorageClassStats{
+			"STANDARD": {FileCount: 1, TotalSize: 1024},
+		},
+	})
+
+	standardTime, bulkTime := slowestRetrieval(estimates)
+	assert.Equal(t, "immediate", standardTime.Time)
+	assert.Equal(t, "immediate", bulkTime.Time)
+}
@@ -1,8 +1,18 @@
 package handlers
 
-import "pluto-restore-assets/internal/types"
+import (
+	"context"
+	"pluto-restore-assets/internal/types"
+)
 
 type JobCreator interface {
-	CreateRestoreJob(params types.RestoreParams) error
+	CreateRestoreJob(params types.RestoreParams) (string, error)
+	DeleteRestoreJob(jobName string) error
 	GetJobLogs(jobName string) (string, error)
 }
+
+type BatchJobManager interface {
+	CancelBatchJob(ctx context.Context, jobID string) error
+	FindBatchJob(ctx context.Context, manifestKey string) (string, error)
+	IsBatchJobForManifest(ctx context.Context, jobID, manifestKey string) (bool, error)
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"cmp"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"pluto-restore-assets/internal/s3utils"
+	"pluto-restore-assets/internal/types"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPreviewPageSize = 100
+	maxPreviewPageSize     = 1000
+)
+
+// previewFile is a file in a restore preview. Files already present locally
+// with the same size aren't restored, so ExistsLocally means a different file
+// is in the way.
+type previewFile struct {
+	s3utils.ManifestObject
+	ExistsLocally bool `json:"existsLocally"`
+}
+
+type previewResponse struct {
+	Files            []previewFile `json:"files"`
+	Page             int           `json:"page"`
+	PageSize         int           `json:"pageSize"`
+	TotalFiles       int           `json:"totalFiles"`
+	TotalPages       int           `json:"totalPages"`
+	TotalSize        int64         `json:"totalSize"`
+	PresentFileCount int           `json:"presentFileCount"`
+	PresentSize      int64         `json:"presentSize"`
+	MissingFiles     []string      `json:"missingFiles,omitempty"`
+}
+
+// previewQuery holds the paging and sorting query parameters of a preview.
+type previewQuery struct {
+	page       int
+	pageSize   int
+	sortBy     string
+	descending bool
+}
+
+// previewSorts compares files by each supported sort field, falling back to the
+// key so that pages are stable.
+var previewSorts = map[string]func(a, b s3utils.ManifestObject) int{
+	"key":          func(a, b s3utils.ManifestObject) int { return strings.Compare(a.Key, b.Key) },
+	"size":         func(a, b s3utils.ManifestObject) int { return cmp.Compare(a.Size, b.Size) },
+	"lastModified": func(a, b s3utils.ManifestObject) int { return a.LastModified.Compare(b.LastModified) },
+	"storageClass": func(a, b s3utils.ManifestObject) int { return strings.Compare(a.StorageClass, b.StorageClass) },
+	"bucket":       func(a, b s3utils.ManifestObject) int { return strings.Compare(a.Bucket, b.Bucket) },
+}
+
+func parsePreviewQuery(query url.Values) (previewQuery, error) {
+	q := previewQuery{page: 1, pageSize: defaultPreviewPageSize, sortBy: "key"}
+	if page := query.Get("page"); page != "" {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			return q, fmt.Errorf("page must be a positive number")
+		}
+		q.page = n
+	}
+	if pageSize := query.Get("pageSize"); pageSize != "" {
+		n, err := strconv.Atoi(pageSize)
+		if err != nil || n < 1 || n > maxPreviewPageSize {
+			return q, fmt.Errorf("pageSize must be between 1 and %d", maxPreviewPageSize)
+		}
+		q.pageSize = n
+	}
+	if sortBy := query.Get("sort"); sortBy != "" {
+		if _, ok := previewSorts[sortBy]; !ok {
+			return q, fmt.Errorf("unknown sort field %q", sortBy)
+		}
+		q.sortBy = sortBy
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.descending = true
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+	return q, nil
+}
+
+// PreviewFiles lists the files a restore request would bring back, a page at a
+// time, using the same selection as the manifest.
+func (h *RestoreHandler) PreviewFiles(w http.ResponseWriter, r *http.Request) {
+	query, err := parsePreviewQuery(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var body types.RequestBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+		return
+	}
+	if err := body.Filter.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid filter: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	params := h.createRestoreParams(body)
+	page := newPreviewPage(query)
+	stats, err := s3utils.PreviewManifest(r.Context(), h.s3Client, params, func(object s3utils.ManifestObject) error {
+		page.add(object)
+		return nil
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to generate manifest: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	objects := page.objects()
+	files := make([]previewFile, 0, len(objects))
+	for _, object := range objects {
+		files = append(files, previewFile{ManifestObject: object, ExistsLocally: existsLocally(params, object.Key)})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(previewResponse{
+		Files:            files,
+		Page:             query.page,
+		PageSize:         query.pageSize,
+		TotalFiles:       page.count,
+		TotalPages:       (page.count + query.pageSize - 1) / query.pageSize,
+		TotalSize:        stats.TotalSize,
+		PresentFileCount: stats.PresentFileCount,
+		PresentSize:      stats.PresentSize,
+		MissingFiles:     stats.MissingKeys,
+	})
+}
+
+// previewPage picks out one page of a preview as the listing streams past, so
+// a large prefix is never held in memory. The listing arrives in key order, so
+// ascending key pages only keep the page itself; other orders keep the files up
+// to the end of the page.
+type previewPage struct {
+	start, end int
+	inOrder    bool // the listing is already in the requested order
+	kept       previewHeap
+	count      int // files seen
+}
+
+func newPreviewPage(query previewQuery) *previewPage {
+	compare := previewSorts[query.sortBy]
+	before := func(a, b s3utils.ManifestObject) bool {
+		c := compare(a, b)
+		if c == 0 {
+			c = strings.Compare(a.Key, b.Key)
+		}
+		if query.descending {
+			return c > 0
+		}
+		return c < 0
+	}
+	start := (query.page - 1) * query.pageSize
+	return &previewPage{
+		start:   start,
+		end:     start + query.pageSize,
+		inOrder: query.sortBy == "key" && !query.descending,
+		kept:    previewHeap{before: before},
+	}
+}
+
+func (p *previewPage) add(object s3utils.ManifestObject) {
+	p.count++
+	if p.inOrder {
+		if p.count > p.start && p.count <= p.end {
+			p.kept.objects = append(p.kept.objects, object)
+		}
+		return
+	}
+	// Keep the first end files in the requested order, dropping the last of them
+	// when an earlier one arrives
+	if len(p.kept.objects) < p.end {
+		heap.Push(&p.kept, object)
+	} else if p.kept.before(object, p.kept.objects[0]) {
+		p.kept.objects[0] = object
+		heap.Fix(&p.kept, 0)
+	}
+}
+
+// objects returns the files on the page in the requested order.
+func (p *previewPage) objects() []s3utils.ManifestObject {
+	if p.inOrder {
+		return p.kept.objects
+	}
+	objects := p.kept.objects
+	sort.Slice(objects, func(i, j int) bool { return p.kept.before(objects[i], objects[j]) })
+	return objects[min(p.start, len(objects)):]
+}
+
+// previewHeap has the file that comes last in the requested order on top.
+type previewHeap struct {
+	objects []s3utils.ManifestObject
+	before  func(a, b s3utils.ManifestObject) bool
+}
+
+func (h previewHeap) Len() int           { return len(h.objects) }
+func (h previewHeap) Less(i, j int) bool { return h.before(h.objects[j], h.objects[i]) }
+func (h previewHeap) Swap(i, j int)      { h.objects[i], h.objects[j] = h.objects[j], h.objects[i] }
+func (h *previewHeap) Push(x interface{}) {
+	h.objects = append(h.objects, x.(s3utils.ManifestObject))
+}
+func (h *previewHeap) Pop() interface{} {
+	old := h.objects
+	object := old[len(old)-1]
+	h.objects = old[:len(old)-1]
+	return object
+}
+
+// existsLocally reports whether a file is already where the worker would restore
+// it, on the multimedia volume the API mounts read-only.
+func existsLocally(params types.RestoreParams, key string) bool {
+	path, err := s3utils.LocalPath(params.BasePath, key, s3utils.KeyEscaping(params.KeyEscaping))
+	if err != nil {
+		return false
+	}
+	_, err = os.Lstat(path)
+	return err == nil
+}
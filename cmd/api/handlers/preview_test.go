@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pluto-restore-assets/internal/types"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3Types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func TestPreviewFiles(t *testing.T) {
+	assetsPath := filepath.Join(t.TempDir(), "Assets")
+	if err := os.MkdirAll(filepath.Join(assetsPath, "Project"), 0775); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(assetsPath, "Project", "b.mov"), []byte("data"), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	s3Client := &MockS3Client{
+		ListObjectsV2Func: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			modified := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+			return &s3.ListObjectsV2Output{
+				Contents: []s3Types.Object{
+					{Key: aws.String("Project/a.mov"), Size: aws.Int64(300), LastModified: aws.Time(modified), StorageClass: s3Types.ObjectStorageClassDeepArchive},
+					{Key: aws.String("Project/b.mov"), Size: aws.Int64(100), LastModified: aws.Time(modified)},
+					{Key: aws.String("Project/c.mov"), Size: aws.Int64(200), LastModified: aws.Time(modified)},
+				},
+				IsTruncated: aws.Bool(false),
+			}, nil
+		},
+	}
+	handler := NewRestoreHandler(&MockJobCreator{}, s3Client, newTestRegistry(t), &MockBatchJobManager{})
+
+	body, _ := json.Marshal(types.RequestBody{ID: 123, User: "test.user@example.com", Path: filepath.Join(assetsPath, "Project"), RetrievalType: "Bulk"})
+	w := httptest.NewRecorder()
+	handler.PreviewFiles(w, httptest.NewRequest("POST", "/stats/files?sort=size&order=desc&pageSize=2&page=1", bytes.NewBuffer(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+
+	var response previewResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.TotalFiles != 3 || response.TotalPages != 2 || response.TotalSize != 600 {
+		t.Errorf("Unexpected totals: %+v", response)
+	}
+	if len(response.Files) != 2 || response.Files[0].Key != "Project/a.mov" || response.Files[1].Key != "Project/c.mov" {
+		t.Fatalf("Unexpected first page: %+v", response.Files)
+	}
+	if response.Files[0].StorageClass != "DEEP_ARCHIVE" || response.Files[1].StorageClass != "STANDARD" {
+		t.Errorf("Unexpected storage classes: %+v", response.Files)
+	}
+
+	w = httptest.NewRecorder()
+	handler.PreviewFiles(w, httptest.NewRequest("POST", "/stats/files?sort=size&order=desc&pageSize=2&page=2", bytes.NewBuffer(body)))
+	response = previewResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Files) != 1 || response.Files[0].Key != "Project/b.mov" || !response.Files[0].ExistsLocally {
+		t.Errorf("Unexpected second page: %+v", response.Files)
+	}
+}
+
+func TestPreviewFilesReportsPresentFiles(t *testing.T) {
+	assetsPath := filepath.Join(t.TempDir(), "Assets")
+	if err := os.MkdirAll(filepath.Join(assetsPath, "Project"), 0775); err != nil {
+		t.Fatal(err)
+	}
+	// c.mov is already restored, so it is counted rather than listed
+	if err := os.WriteFile(filepath.Join(assetsPath, "Project", "c.mov"), make([]byte, 200), 0664); err != nil {
+		t.Fatal(err)
+	}
+
+	s3Client := &MockS3Client{
+		ListObjectsV2Func: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			return &s3.ListObjectsV2Output{
+				Contents: []s3Types.Object{
+					{Key: aws.String("Project/a.mov"), Size: aws.Int64(300)},
+					{Key: aws.String("Project/b.mov"), Size: aws.Int64(100)},
+					{Key: aws.String("Project/c.mov"), Size: aws.Int64(200)},
+				},
+				IsTruncated: aws.Bool(false),
+			}, nil
+		},
+	}
+	handler := NewRestoreHandler(&MockJobCreator{}, s3Client, newTestRegistry(t), &MockBatchJobManager{})
+	body, _ := json.Marshal(types.RequestBody{ID: 123, User: "test.user@example.com", Path: filepath.Join(assetsPath, "Project"), RetrievalType: "Bulk"})
+
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"sort=key&pageSize=1&page=2", "Project/b.mov"},
+		{"sort=key&order=desc&pageSize=1&page=1", "Project/b.mov"},
+		{"sort=size&pageSize=1&page=2", "Project/a.mov"},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		handler.PreviewFiles(w, httptest.NewRequest("POST", "/stats/files?"+tt.query, bytes.NewBuffer(body)))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status %d, got %d: %s", tt.query, http.StatusOK, w.Code, w.Body.String())
+		}
+
+		var response previewResponse
+		if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.TotalFiles != 2 || response.TotalPages != 2 || response.TotalSize != 400 {
+			t.Errorf("%s: unexpected totals: %+v", tt.query, response)
+		}
+		if response.PresentFileCount != 1 || response.PresentSize != 200 {
+			t.Errorf("%s: expected 1 present file of 200 bytes, got %d of %d", tt.query, response.PresentFileCount, response.PresentSize)
+		}
+		if len(response.Files) != 1 || response.Files[0].Key != tt.expected {
+			t.Errorf("%s: expected %s, got %+v", tt.query, tt.expected, response.Files)
+		}
+	}
+}
+
+func TestPreviewFilesRejectsInvalidQuery(t *testing.T) {
+	handler := NewRestoreHandler(&MockJobCreator{}, &MockS3Client{}, newTestRegistry(t), &MockBatchJobManager{})
+
+	for _, query := range []string{"page=0", "pageSize=5000", "sort=name", "order=up"} {
+		w := httptest.NewRecorder()
+		handler.PreviewFiles(w, httptest.NewRequest("POST", "/stats/files?"+query, bytes.NewBufferString("{}")))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %d, got %d", query, http.StatusBadRequest, w.Code)
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"pluto-restore-assets/internal/registry"
+	"pluto-restore-assets/internal/types"
+	"strconv"
+	"time"
+)
+
+// GetRestore returns the registry record for a single restore request.
+func (h *RestoreHandler) GetRestore(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "ID is required", http.StatusBadRequest)
+		return
+	}
+
+	record, err := h.registry.Get(id)
+	if errors.Is(err, registry.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Restore %s not found", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load restore: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
+
+// ListRestores returns all known restore requests, optionally filtered by the
+// projectId and state query parameters.
+func (h *RestoreHandler) ListRestores(w http.ResponseWriter, r *http.Request) {
+	var filter registry.ListFilter
+
+	if projectId := r.URL.Query().Get("projectId"); projectId != "" {
+		id, err := strconv.Atoi(projectId)
+		if err != nil {
+			http.Error(w, "projectId must be a number", http.StatusBadRequest)
+			return
+		}
+		filter.ProjectId = id
+	}
+	filter.State = types.RestoreState(r.URL.Query().Get("state"))
+
+	records, err := h.registry.List(filter)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to list restores: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
+
+// CancelRestore marks a restore cancelled in the registry, then stops it by
+// deleting its Kubernetes job and cancelling its S3 Batch Operations job. If
+// either can't be stopped the restore keeps its state, so the request can be
+// repeated.
+func (h *RestoreHandler) CancelRestore(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "ID is required", http.StatusBadRequest)
+		return
+	}
+
+	record, err := h.registry.Get(id)
+	if errors.Is(err, registry.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Restore %s not found", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to load restore: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	switch record.State {
+	case types.RestoreStateCompleted, types.RestoreStateFailed, types.RestoreStateCancelled:
+		http.Error(w, fmt.Sprintf("Restore %s is already %s", id, record.State), http.StatusConflict)
+		return
+	}
+
+	// Mark the restore cancelled before stopping the worker, so the worker can
+	// tell a cancellation from an eviction and remove its partial downloads
+	var cancelled *types.RestoreRecord
+	err = h.registry.Update(id, func(record *types.RestoreRecord) error {
+		record.State = types.RestoreStateCancelled
+		cancelled = record
+		return nil
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to mark restore cancelled: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	// Delete the worker first so it cannot start a new batch job while we cancel the current one
+	if cancelled.JobName != "" {
+		if err := h.jobCreator.DeleteRestoreJob(cancelled.JobName); err != nil {
+			h.restoreState(id, record.State)
+			http.Error(w, fmt.Sprintf("Failed to delete restore job: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// The worker's report of its batch job may never have arrived, so look it up
+	// by manifest. Doing this after deleting the worker also catches a batch job
+	// it created just before it stopped.
+	batchJobID := cancelled.BatchJobID
+	if batchJobID == "" && cancelled.ManifestKey != "" {
+		batchJobID, err = h.batchJobs.FindBatchJob(r.Context(), cancelled.ManifestKey)
+		if err != nil {
+			h.restoreState(id, record.State)
+			http.Error(w, fmt.Sprintf("Failed to look up batch job: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if batchJobID != "" {
+		if err := h.batchJobs.CancelBatchJob(r.Context(), batchJobID); err != nil {
+			h.restoreState(id, record.State)
+			http.Error(w, fmt.Sprintf("Failed to cancel batch job: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	if cancelled.BatchJobID == "" && batchJobID != "" {
+		err = h.registry.Update(id, func(record *types.RestoreRecord) error {
+			record.BatchJobID = batchJobID
+			cancelled = record
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to record batch job %s for cancelled restore %s: %v", batchJobID, id, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cancelled)
+}
+
+// ReportProgress receives phase transitions posted by the restore worker and
+// stores them against the restore record.
+func (h *RestoreHandler) ReportProgress(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if id == "" {
+		http.Error(w, "ID is required", http.StatusBadRequest)
+		return
+	}
+
+	var update types.ProgressUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
+		return
+	}
+	if update.Phase == "" {
+		http.Error(w, "Phase is required", http.StatusBadRequest)
+		return
+	}
+	if !update.Phase.Valid() {
+		http.Error(w, fmt.Sprintf("Invalid phase %q", update.Phase), http.StatusBadRequest)
+		return
+	}
+	if update.Done < 0 || update.Total < 0 || update.Done > update.Total {
+		http.Error(w, fmt.Sprintf("Invalid progress %d of %d", update.Done, update.Total), http.StatusBadRequest)
+		return
+	}
+	if update.Timestamp.IsZero() {
+		update.Timestamp = time.Now()
+	}
+
+	// A cancelled restore cancels the batch job recorded here, so it must be the
+	// one restoring this restore's manifest
+	if update.Phase == types.RestorePhaseBatchJobCreated && update.BatchJobID != "" {
+		record, err := h.registry.Get(id)
+		if errors.Is(err, registry.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("Restore %s not found", id), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to load restore: %v", err), http.StatusInternalServerError)
+			return
+		}
+		ours, err := h.batchJobs.IsBatchJobForManifest(r.Context(), update.BatchJobID, record.ManifestKey)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check batch job: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if !ours {
+			http.Error(w, fmt.Sprintf("Batch job %s does not restore the manifest of restore %s", update.BatchJobID, id), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := h.registry.Update(id, func(record *types.RestoreRecord) error {
+		applyProgress(record, update)
+		return nil
+	})
+	if errors.Is(err, registry.ErrNotFound) {
+		http.Error(w, fmt.Sprintf("Restore %s not found", id), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to record progress: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func applyProgress(record *types.RestoreRecord, update types.ProgressUpdate) {
+	if record.Progress == nil {
+		record.Progress = make(map[types.RestorePhase]types.ProgressUpdate)
+	}
+	record.Progress[update.Phase] = update
+	record.Phase = update.Phase
+
+	// A worker that is still shutting down must not resurrect a cancelled restore
+	if record.State == types.RestoreStateCancelled {
+		return
+	}
+
+	switch update.Phase {
+	case types.RestorePhaseBatchJobCreated:
+		record.BatchJobID = update.BatchJobID
+		record.State = types.RestoreStateRunning
+	case types.RestorePhaseNotificationSent:
+		record.State = types.RestoreStateCompleted
+	case types.RestorePhaseFailed:
+		record.State = types.RestoreStateFailed
+		record.Error = update.Message
+	default:
+		record.State = types.RestoreStateRunning
+	}
+}
+
+// restoreState puts back the state of a restore that could not be cancelled.
+func (h *RestoreHandler) restoreState(id string, state types.RestoreState) {
+	err := h.registry.Update(id, func(record *types.RestoreRecord) error {
+		record.State = state
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to reset state of restore %s: %v", id, err)
+	}
+}
+
+func (h *RestoreHandler) markFailed(id string, cause error) {
+	err := h.registry.Update(id, func(record *types.RestoreRecord) error {
+		record.State = types.RestoreStateFailed
+		record.Error = cause.Error()
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to mark restore %s as failed: %v", id, err)
+	}
+}
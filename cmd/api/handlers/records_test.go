@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"pluto-restore-assets/internal/registry"
+	"pluto-restore-assets/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type MockBatchJobManager struct {
+	jobsByManifest map[string]string
+	cancelledJobs  []string
+}
+
+func (m *MockBatchJobManager) IsBatchJobForManifest(ctx context.Context, jobID, manifestKey string) (bool, error) {
+	return m.jobsByManifest[manifestKey] == jobID, nil
+}
+
+func (m *MockBatchJobManager) CancelBatchJob(ctx context.Context, jobID string) error {
+	m.cancelledJobs = append(m.cancelledJobs, jobID)
+	return nil
+}
+
+func (m *MockBatchJobManager) FindBatchJob(ctx context.Context, manifestKey string) (string, error) {
+	return m.jobsByManifest[manifestKey], nil
+}
+
+func newTestRegistry(t *testing.T) registry.Repository {
+	repo, err := registry.NewBoltRepository(filepath.Join(t.TempDir(), "restores.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestGetRestore(t *testing.T) {
+	repo := newTestRegistry(t)
+	assert.NoError(t, repo.Create(&types.RestoreRecord{
+		ID:        "abc",
+		ProjectId: 1234,
+		JobName:   "restore-job-1234-1",
+		State:     types.RestoreStateJobCreated,
+	}))
+
+	handler := NewRestoreHandler(&MockJobCreator{}, &MockS3Client{}, repo, &MockBatchJobManager{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /restore/{id}", handler.GetRestore)
+
+	t.Run("Existing restore", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/restore/abc", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var record types.RestoreRecord
+		assert.NoError(t, json.NewDecoder(w.Body).Decode(&record))
+		assert.Equal(t, 1234, record.ProjectId)
+		assert.Equal(t, "restore-job-1234-1", record.JobName)
+		assert.Equal(t, types.RestoreStateJobCreated, record.State)
+	})
+
+	t.Run("Unknown restore", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", "/restore/missing", nil))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestListRestores(t *testing.T) {
+	repo := newTestRegistry(t)
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "1", ProjectId: 1234}))
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "2", ProjectId: 5678}))
+
+	handler := NewRestoreHandler(&MockJobCreator{}, &MockS3Client{}, repo, &MockBatchJobManager{})
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{"All restores", "/restores", http.StatusOK, 2},
+		{"Filtered by project", "/restores?projectId=1234", http.StatusOK, 1},
+		{"Invalid project ID", "/restores?projectId=abc", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ListRestores(w, httptest.NewRequest("GET", tt.url, nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+			var records []types.RestoreRecord
+			assert.NoError(t, json.NewDecoder(w.Body).Decode(&records))
+			assert.Len(t, records, tt.expectedCount)
+		})
+	}
+}
+
+func TestReportProgress(t *testing.T) {
+	repo := newTestRegistry(t)
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "abc", ProjectId: 1234, ManifestKey: "batch-manifests/abc.csv", State: types.RestoreStateJobCreated}))
+
+	batchJobs := &MockBatchJobManager{jobsByManifest: map[string]string{
+		"batch-manifests/abc.csv":   "batch-1",
+		"batch-manifests/other.csv": "batch-2",
+	}}
+	handler := NewRestoreHandler(&MockJobCreator{}, &MockS3Client{}, repo, batchJobs)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /internal/restore/{id}/progress", handler.ReportProgress)
+
+	post := func(id string, update types.ProgressUpdate) int {
+		body, _ := json.Marshal(update)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("POST", "/internal/restore/"+id+"/progress", bytes.NewBuffer(body)))
+		return w.Code
+	}
+
+	// Another restore's batch job is refused
+	assert.Equal(t, http.StatusBadRequest, post("abc", types.ProgressUpdate{Phase: types.RestorePhaseBatchJobCreated, BatchJobID: "batch-2"}))
+	assert.Equal(t, http.StatusNoContent, post("abc", types.ProgressUpdate{Phase: types.RestorePhaseBatchJobCreated, BatchJobID: "batch-1"}))
+	assert.Equal(t, http.StatusNoContent, post("abc", types.ProgressUpdate{Phase: types.RestorePhaseObjectsThawed, Done: 3, Total: 10}))
+
+	record, err := repo.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "batch-1", record.BatchJobID)
+	assert.Equal(t, types.RestoreStateRunning, record.State)
+	assert.Equal(t, types.RestorePhaseObjectsThawed, record.Phase)
+	assert.Equal(t, 3, record.Progress[types.RestorePhaseObjectsThawed].Done)
+	assert.Equal(t, 10, record.Progress[types.RestorePhaseObjectsThawed].Total)
+
+	assert.Equal(t, http.StatusNoContent, post("abc", types.ProgressUpdate{Phase: types.RestorePhaseFailed, Message: "download files: boom"}))
+	record, err = repo.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, types.RestoreStateFailed, record.State)
+	assert.Equal(t, "download files: boom", record.Error)
+
+	assert.Equal(t, http.StatusNotFound, post("missing", types.ProgressUpdate{Phase: types.RestorePhaseFailed}))
+	assert.Equal(t, http.StatusBadRequest, post("abc", types.ProgressUpdate{}))
+	assert.Equal(t, http.StatusBadRequest, post("abc", types.ProgressUpdate{Phase: "objects_thawd"}))
+	assert.Equal(t, http.StatusBadRequest, post("abc", types.ProgressUpdate{Phase: types.RestorePhaseFilesDownloaded, Done: 11, Total: 10}))
+	assert.Equal(t, http.StatusBadRequest, post("abc", types.ProgressUpdate{Phase: types.RestorePhaseFilesDownloaded, Done: -1}))
+
+	// Rejected updates leave the record alone
+	record, err = repo.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, types.RestorePhaseFailed, record.Phase)
+	assert.NotContains(t, record.Progress, types.RestorePhaseFilesDownloaded)
+}
+
+func TestCancelRestore(t *testing.T) {
+	repo := newTestRegistry(t)
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "running", JobName: "restore-job-1234-1", BatchJobID: "batch-1", State: types.RestoreStateRunning}))
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "pending", State: types.RestoreStatePending}))
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "done", JobName: "restore-job-1234-2", State: types.RestoreStateCompleted}))
+
+	jobCreator := &MockJobCreator{}
+	batchJobs := &MockBatchJobManager{}
+	handler := NewRestoreHandler(jobCreator, &MockS3Client{}, repo, batchJobs)
+	mux := http.NewServeMux()
+	mux.HandleFunc("DELETE /restore/{id}", handler.CancelRestore)
+
+	cancel := func(id string) int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("DELETE", "/restore/"+id, nil))
+		return w.Code
+	}
+
+	// The worker can see the restore was cancelled as soon as it is stopped
+	var stateWhenDeleted types.RestoreState
+	jobCreator.onDelete = func(jobName string) {
+		record, err := repo.Get("running")
+		assert.NoError(t, err)
+		stateWhenDeleted = record.State
+	}
+	assert.Equal(t, http.StatusOK, cancel("running"))
+	assert.Equal(t, types.RestoreStateCancelled, stateWhenDeleted)
+	jobCreator.onDelete = nil
+	assert.Equal(t, []string{"restore-job-1234-1"}, jobCreator.deletedJobs)
+	assert.Equal(t, []string{"batch-1"}, batchJobs.cancelledJobs)
+	record, err := repo.Get("running")
+	assert.NoError(t, err)
+	assert.Equal(t, types.RestoreStateCancelled, record.State)
+
+	// Nothing to tear down yet, but the restore is still marked cancelled
+	assert.Equal(t, http.StatusOK, cancel("pending"))
+	assert.Len(t, jobCreator.deletedJobs, 1)
+	assert.Len(t, batchJobs.cancelledJobs, 1)
+
+	assert.Equal(t, http.StatusConflict, cancel("done"))
+	assert.Equal(t, http.StatusConflict, cancel("running"))
+
+	// A restore whose worker couldn't be stopped keeps its state so it can be cancelled again
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "stuck", JobName: "restore-job-1234-4", State: types.RestoreStateRunning}))
+	jobCreator.deleteErr = errors.New("api server unavailable")
+	assert.Equal(t, http.StatusInternalServerError, cancel("stuck"))
+	record, err = repo.Get("stuck")
+	assert.NoError(t, err)
+	assert.Equal(t, types.RestoreStateRunning, record.State)
+	jobCreator.deleteErr = nil
+
+	// A batch job the worker never reported is found by its manifest
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "unreported", JobName: "restore-job-1234-3", ManifestKey: "batch-manifests/unreported.csv", State: types.RestoreStateRunning}))
+	batchJobs.jobsByManifest = map[string]string{"batch-manifests/unreported.csv": "batch-2"}
+	assert.Equal(t, http.StatusOK, cancel("unreported"))
+	assert.Equal(t, []string{"batch-1", "batch-2"}, batchJobs.cancelledJobs)
+	record, err = repo.Get("unreported")
+	assert.NoError(t, err)
+	assert.Equal(t, "batch-2", record.BatchJobID)
+	assert.Equal(t, http.StatusNotFound, cancel("missing"))
+
+	// Late progress from the terminating worker does not revive the restore
+	record, err = repo.Get("running")
+	assert.NoError(t, err)
+	applyProgress(record, types.ProgressUpdate{Phase: types.RestorePhaseFilesDownloaded, Done: 1, Total: 2})
+	assert.Equal(t, types.RestoreStateCancelled, record.State)
+}
@@ -12,10 +12,13 @@ import (
 	"strings"
 	"time"
 
+	"pluto-restore-assets/internal/diskspace"
 	"pluto-restore-assets/internal/notification"
+	"pluto-restore-assets/internal/registry"
 	"pluto-restore-assets/internal/s3utils"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
 )
 
 type S3ClientAPI interface {
@@ -27,13 +30,17 @@ type S3ClientAPI interface {
 type RestoreHandler struct {
 	jobCreator JobCreator
 	s3Client   S3ClientAPI
+	registry   registry.Repository
+	batchJobs  BatchJobManager
 	statsCache map[string]*types.RestoreStats
 }
 
-func NewRestoreHandler(jobCreator JobCreator, s3Client S3ClientAPI) *RestoreHandler {
+func NewRestoreHandler(jobCreator JobCreator, s3Client S3ClientAPI, registry registry.Repository, batchJobs BatchJobManager) *RestoreHandler {
 	return &RestoreHandler{
 		jobCreator: jobCreator,
 		s3Client:   s3Client,
+		registry:   registry,
+		batchJobs:  batchJobs,
 		statsCache: make(map[string]*types.RestoreStats),
 	}
 }
@@ -71,37 +78,145 @@ func (h *RestoreHandler) CreateRestore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if body.ConflictPolicy == "" {
+		body.ConflictPolicy = string(types.ConflictPolicySkipIfIdentical)
+	}
+	if !types.ConflictPolicy(body.ConflictPolicy).Valid() {
+		http.Error(w, fmt.Sprintf("Invalid conflict policy %q", body.ConflictPolicy), http.StatusBadRequest)
+		return
+	}
+
+	if err := body.Filter.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid filter: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	log.Printf("Received request body: %+v", body)
 
 	params := h.createRestoreParams(body)
+	params.RestoreID = uuid.NewString()
+
+	record := &types.RestoreRecord{
+		ID:            params.RestoreID,
+		ProjectId:     body.ID,
+		User:          body.User,
+		Path:          body.Path,
+		RetrievalType: body.RetrievalType,
+		ManifestKey:   params.ManifestKey,
+		State:         types.RestoreStatePending,
+	}
+	if err := h.registry.Create(record); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to record restore request: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	manifestPath, err := newManifestPath(".csv")
+	if err != nil {
+		h.markFailed(record.ID, err)
+		http.Error(w, fmt.Sprintf("Failed to generate manifest: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(manifestPath)
+	params.ManifestLocalPath = manifestPath
+
+	availablePath, err := newManifestPath(".csv.gz")
+	if err != nil {
+		h.markFailed(record.ID, err)
+		http.Error(w, fmt.Sprintf("Failed to generate manifest: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(availablePath)
+	params.AvailableLocalPath = availablePath
 
 	// Generate manifest first
 	stats, err := s3utils.GenerateCSVManifest(r.Context(), h.s3Client, params)
 	if err != nil {
+		h.markFailed(record.ID, fmt.Errorf("generate manifest: %w", err))
 		http.Error(w, fmt.Sprintf("Failed to generate manifest: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Upload manifest to S3
+	// Everything is on disk already, so there is no job to run
+	if stats.FileCount == 0 {
+		err = h.registry.Update(record.ID, func(record *types.RestoreRecord) error {
+			record.State = types.RestoreStateCompleted
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to update restore record %s: %v", params.RestoreID, err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(types.RestoreResponse{
+			Message:          fmt.Sprintf("Nothing to restore: all %d files are already present", stats.PresentFileCount),
+			JobID:            record.ID,
+			PresentFileCount: int64(stats.PresentFileCount),
+		})
+		return
+	}
+
+	// Upload manifests to S3
 	_, err = s3utils.UploadFileToS3(r.Context(), h.s3Client, params.ManifestBucket, params.ManifestKey, params.ManifestLocalPath)
 	if err != nil {
+		h.markFailed(record.ID, fmt.Errorf("upload manifest: %w", err))
+		http.Error(w, fmt.Sprintf("Failed to upload manifest: %v", err), http.StatusInternalServerError)
+		return
+	}
+	_, err = s3utils.UploadFileToS3(r.Context(), h.s3Client, params.ManifestBucket, params.AvailableManifestKey, params.AvailableLocalPath)
+	if err != nil {
+		h.markFailed(record.ID, fmt.Errorf("upload available manifest: %w", err))
 		http.Error(w, fmt.Sprintf("Failed to upload manifest: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	params.TotalSize = stats.TotalSize
+
+	err = h.registry.Update(record.ID, func(record *types.RestoreRecord) error {
+		record.FileCount = int64(stats.FileCount)
+		record.TotalSize = stats.TotalSize
+		return nil
+	})
+	if err != nil {
+		log.Printf("Failed to update restore record %s: %v", record.ID, err)
+	}
+
 	// Create the restore job asynchronously
 	go func() {
-		if err := h.jobCreator.CreateRestoreJob(params); err != nil {
+		jobName, err := h.jobCreator.CreateRestoreJob(params)
+		if err != nil {
 			log.Printf("Failed to create restore job: %v", err)
+			h.markFailed(params.RestoreID, fmt.Errorf("create restore job: %w", err))
+			return
+		}
+		cancelled := false
+		err = h.registry.Update(params.RestoreID, func(record *types.RestoreRecord) error {
+			record.JobName = jobName
+			if record.State == types.RestoreStateCancelled {
+				cancelled = true
+				return nil
+			}
+			record.State = types.RestoreStateJobCreated
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to update restore record %s: %v", params.RestoreID, err)
+		}
+		// The restore was cancelled while its job was being created
+		if cancelled {
+			if err := h.jobCreator.DeleteRestoreJob(jobName); err != nil {
+				log.Printf("Failed to delete job %s for cancelled restore %s: %v", jobName, params.RestoreID, err)
+			}
 		}
 	}()
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusAccepted)
 	json.NewEncoder(w).Encode(types.RestoreResponse{
-		Message:   "Restore job created",
-		FileCount: int64(stats.FileCount),
-		TotalSize: int64(stats.TotalSize),
+		Message:          "Restore job created",
+		JobID:            record.ID,
+		FileCount:        int64(stats.FileCount),
+		TotalSize:        int64(stats.TotalSize),
+		MissingFiles:     stats.MissingKeys,
+		PresentFileCount: int64(stats.PresentFileCount),
 	})
 }
 
@@ -113,6 +228,21 @@ func GetAWSAssetPath(fullPath string) string {
 	return fullPath + "/"
 }
 
+// GetAWSAssetKeys converts asset paths to S3 keys like GetAWSAssetPath. Entries
+// that aren't under an Assets folder are taken to be keys already, and folders
+// keep their trailing slash.
+func GetAWSAssetKeys(files []string) []string {
+	var keys []string
+	for _, file := range files {
+		if _, key, found := strings.Cut(file, "/Assets/"); found {
+			keys = append(keys, key)
+		} else {
+			keys = append(keys, strings.TrimPrefix(file, "/"))
+		}
+	}
+	return keys
+}
+
 func GetBasePath(fullPath string) string {
 	parts := strings.Split(fullPath, "/Assets/")
 	if len(parts) > 1 {
@@ -121,11 +251,28 @@ func GetBasePath(fullPath string) string {
 	return fullPath
 }
 
+// newManifestPath reserves a unique local file for a single request's manifest so
+// concurrent requests cannot overwrite each other's manifests. Manifests with a
+// ".gz" extension are gzipped.
+func newManifestPath(ext string) (string, error) {
+	file, err := os.CreateTemp("", "manifest-*"+ext)
+	if err != nil {
+		return "", fmt.Errorf("failed to create manifest file: %w", err)
+	}
+	defer file.Close()
+	return file.Name(), nil
+}
+
 func envToInt(key string) int {
 	i, _ := strconv.Atoi(os.Getenv(key))
 	return i
 }
 
+func envToBool(key string) bool {
+	b, _ := strconv.ParseBool(os.Getenv(key))
+	return b
+}
+
 func (h *RestoreHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 	log.Printf("GetStatus called: Received request to %s", r.URL.Path)
 
@@ -140,60 +287,85 @@ func (h *RestoreHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to parse request body", http.StatusBadRequest)
 		return
 	}
+	if err := body.Filter.Validate(); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid filter: %v", err), http.StatusBadRequest)
+		return
+	}
 
 	params := h.createRestoreParams(body)
 
+	manifestPath, err := newManifestPath(".csv")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to generate manifest: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(manifestPath)
+	params.ManifestLocalPath = manifestPath
+
 	stats, err := s3utils.GenerateCSVManifest(r.Context(), h.s3Client, params)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to generate manifest: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	standardCost, bulkCost := calculateGlacierRetrievalCosts(float64(stats.FileCount), float64(stats.TotalSize))
+	estimates, standardCost, bulkCost := estimateRestore(stats)
+	standardTime, bulkTime := slowestRetrieval(estimates)
 
 	// Cache the stats using project ID as key
 	cacheKey := fmt.Sprintf("%d", body.ID)
 	h.statsCache[cacheKey] = &types.RestoreStats{
-		FileCount:    int64(stats.FileCount),
-		TotalSize:    stats.TotalSize,
-		StandardCost: standardCost,
-		BulkCost:     bulkCost,
-		Timestamp:    time.Now(),
+		FileCount:      int64(stats.FileCount),
+		TotalSize:      stats.TotalSize,
+		StandardCost:   standardCost,
+		BulkCost:       bulkCost,
+		StorageClasses: estimates,
+		Timestamp:      time.Now(),
 	}
 
 	log.Printf("Received request body: %+v", r.Body)
 	log.Printf("Total size: %v", stats.TotalSize)
 
+	// The API pod mounts the multimedia volume read-only to check the restore fits,
+	// reporting null if it can't tell
+	var freeSpace *float64
+	var fits *bool
+	if estimate, err := diskspace.Check(params.BasePath, stats.TotalSize, diskspace.Headroom(params.FreeSpaceHeadroomGB)); err != nil {
+		log.Printf("Failed to check free space for %s: %v", params.BasePath, err)
+	} else {
+		freeGB := float64(estimate.Free) / float64(1024*1024*1024)
+		freeSpace, fits = &freeGB, &estimate.Fits
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"numberOfFiles":         stats.FileCount,
+		"restoreFileCount":      stats.RestoreFileCount,
+		"availableFileCount":    stats.AvailableFileCount,
 		"totalSize":             float64(stats.TotalSize) / float64(1024*1024*1024), // Convert to GB
 		"standardRetrievalCost": standardCost,
 		"bulkRetrievalCost":     bulkCost,
+		"standardRetrievalTime": standardTime.Time,
+		"bulkRetrievalTime":     bulkTime.Time,
+		"storageClasses":        estimates,
+		"freeSpace":             freeSpace, // GB
+		"fitsOnVolume":          fits,
+		"missingFiles":          stats.MissingKeys,
+		"presentFileCount":      stats.PresentFileCount,
+		"presentSize":           float64(stats.PresentSize) / float64(1024*1024*1024), // GB
+		"summary":               fmt.Sprintf("%d files already present, %d to restore", stats.PresentFileCount, stats.FileCount),
 	})
 }
 
-const (
-	// Restore request costs per 1000 requests
-	STANDARD_RESTORE_REQUEST_COST_PER_1000 = 0.03  // $0.03 per 1000 requests
-	BULK_RESTORE_REQUEST_COST_PER_1000     = 0.025 // $0.025 per 1000 requests
-
-	// GET request costs per 1000 requests
-	GET_REQUEST_COST_PER_1000 = 0.0004 // $0.0004 per 1000 requests
-
-	// Data transfer cost
-	DATA_TRANSFER_COST_PER_GB = 0.09 // $0.09 per GB
-)
-
 func (h *RestoreHandler) createRestoreParams(body types.RequestBody) types.RestoreParams {
 	parts := strings.Split(body.User, "@")[0]
 	user := strings.Replace(parts, ".", "_", 1)
+	manifestName := fmt.Sprintf("batch-manifests/%d_%v_%s", body.ID, user, time.Now().Format("2006-01-02_15-04-05"))
 
 	return types.RestoreParams{
 		AssetBucketList:       strings.Split(os.Getenv("ASSET_BUCKET_LIST"), ","),
 		ManifestBucket:        os.Getenv("MANIFEST_BUCKET"),
-		ManifestKey:           fmt.Sprintf("batch-manifests/%d_%v_%s.csv", body.ID, user, time.Now().Format("2006-01-02_15-04-05")),
-		ManifestLocalPath:     "/tmp/manifest.csv",
+		ManifestKey:           manifestName + ".csv",              // S3 Batch Operations only reads plain CSV
+		AvailableManifestKey:  manifestName + "_available.csv.gz", // read only by the worker, so compressed
 		RoleArn:               os.Getenv("AWS_ROLE_ARN"),
 		AWS_ACCESS_KEY_ID:     os.Getenv("AWS_ACCESS_KEY_ID"),
 		AWS_SECRET_ACCESS_KEY: os.Getenv("AWS_SECRET_ACCESS_KEY"),
@@ -210,28 +382,26 @@ func (h *RestoreHandler) createRestoreParams(body types.RequestBody) types.Resto
 		PlutoProjectURL:       os.Getenv("PLUTO_PROJECT_URL"),
 		FileOwnerUID:          envToInt("FILE_OWNER_UID"),
 		FileOwnerGID:          envToInt("FILE_OWNER_GID"),
+		ProgressURL:           os.Getenv("API_INTERNAL_URL"),
+		PollWorkers:           envToInt("RESTORE_POLL_WORKERS"),
+		HeadObjectRate:        envToInt("RESTORE_HEAD_OBJECT_RATE"),
+		PollInterval:          os.Getenv("RESTORE_POLL_INTERVAL"),
+		RestoreEventQueueURL:  os.Getenv("RESTORE_EVENT_QUEUE_URL"),
+		QuarantinePath:        os.Getenv("RESTORE_QUARANTINE_PATH"),
+		ConflictPolicy:        body.ConflictPolicy,
+		DownloadWorkers:       envToInt("RESTORE_DOWNLOAD_WORKERS"),
+		PartConcurrency:       envToInt("RESTORE_PART_CONCURRENCY"),
+		PartSizeMB:            envToInt("RESTORE_PART_SIZE_MB"),
+		BandwidthLimitMB:      envToInt("RESTORE_BANDWIDTH_LIMIT_MB"),
+		BandwidthSchedule:     os.Getenv("RESTORE_BANDWIDTH_SCHEDULE"),
+		FreeSpaceHeadroomGB:   envToInt("RESTORE_FREE_SPACE_HEADROOM_GB"),
+		PreserveAttributes:    envToBool("RESTORE_PRESERVE_ATTRIBUTES"),
+		KeyEscaping:           os.Getenv("RESTORE_KEY_ESCAPING"),
+		Filter:                body.Filter,
+		Files:                 GetAWSAssetKeys(body.Files),
 	}
 }
 
-func calculateGlacierRetrievalCosts(numberOfFiles float64, totalDataBytes float64) (float64, float64) {
-	// Convert bytes to GB
-	totalDataGB := totalDataBytes / (1024 * 1024 * 1024)
-
-	// Standard Retrieval Cost Calculation
-	standardRestoreRequestCost := (numberOfFiles * STANDARD_RESTORE_REQUEST_COST_PER_1000) / 1000
-	standardGetRequestCost := (numberOfFiles * GET_REQUEST_COST_PER_1000) / 1000
-	standardDataTransferCost := totalDataGB * DATA_TRANSFER_COST_PER_GB
-	totalStandardCost := standardRestoreRequestCost + standardGetRequestCost + standardDataTransferCost
-
-	// Bulk Retrieval Cost Calculation
-	bulkRestoreRequestCost := (numberOfFiles * BULK_RESTORE_REQUEST_COST_PER_1000) / 1000
-	bulkGetRequestCost := (numberOfFiles * GET_REQUEST_COST_PER_1000) / 1000
-	bulkDataTransferCost := totalDataGB * DATA_TRANSFER_COST_PER_GB
-	totalBulkCost := bulkRestoreRequestCost + bulkGetRequestCost + bulkDataTransferCost
-
-	return totalStandardCost, totalBulkCost
-}
-
 func (h *RestoreHandler) Notify(w http.ResponseWriter, r *http.Request) {
 	log.Printf("Notify called: Received request to %s", r.URL.Path)
 	var body types.RequestBody
@@ -254,6 +424,8 @@ func (h *RestoreHandler) Notify(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	standardTime, bulkTime := slowestRetrieval(cachedStats.StorageClasses)
+
 	emailSender := notification.NewSMTPEmailSender(
 		os.Getenv("SMTP_HOST"),
 		os.Getenv("SMTP_PORT"),
@@ -279,11 +451,14 @@ Restore Statistics:
 
 Estimated Costs:
 --------------
-• Standard Retrieval: $%.2f
-• Bulk Retrieval: $%.2f
-
-Note: Bulk retrieval is cheaper but takes longer (up to 12 hours).
-Standard retrieval typically completes within 3-5 hours.
+• Standard Retrieval: $%.2f (%s)
+• Bulk Retrieval: $%.2f (%s)
+
+By Storage Class:
+----------------
+%s
+Note: Bulk retrieval is cheaper but takes longer. Objects in DEEP_ARCHIVE
+take considerably longer to restore than objects in GLACIER.
 `,
 		body.ID,
 		os.Getenv("PLUTO_PROJECT_URL"), body.ID,
@@ -291,8 +466,9 @@ Standard retrieval typically completes within 3-5 hours.
 		body.RetrievalType,
 		cachedStats.FileCount,
 		float64(cachedStats.TotalSize)/(1024*1024*1024),
-		cachedStats.StandardCost,
-		cachedStats.BulkCost)
+		cachedStats.StandardCost, standardTime.Time,
+		cachedStats.BulkCost, bulkTime.Time,
+		formatStorageClassBreakdown(cachedStats.StorageClasses))
 
 	if err := emailSender.SendEmail(subject, emailBody); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to send notification: %v", err), http.StatusInternalServerError)
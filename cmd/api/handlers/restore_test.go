@@ -9,7 +9,9 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"pluto-restore-assets/internal/types"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -22,13 +24,27 @@ import (
 type MockJobCreator struct {
 	createCalled bool
 	shouldError  bool
+	deletedJobs  []string
+	deleteErr    error
+	onDelete     func(jobName string)
 }
 
-func (m *MockJobCreator) CreateRestoreJob(params types.RestoreParams) error {
+func (m *MockJobCreator) CreateRestoreJob(params types.RestoreParams) (string, error) {
 	m.createCalled = true
 	if m.shouldError {
-		return fmt.Errorf("mock error")
+		return "", fmt.Errorf("mock error")
 	}
+	return fmt.Sprintf("restore-job-%d-1", params.ProjectId), nil
+}
+
+func (m *MockJobCreator) DeleteRestoreJob(jobName string) error {
+	if m.onDelete != nil {
+		m.onDelete(jobName)
+	}
+	if m.deleteErr != nil {
+		return m.deleteErr
+	}
+	m.deletedJobs = append(m.deletedJobs, jobName)
 	return nil
 }
 
@@ -237,6 +253,48 @@ func TestCreateRestore(t *testing.T) {
 	}
 }
 
+func TestCreateRestoreRejectsUnknownConflictPolicy(t *testing.T) {
+	handler := NewRestoreHandler(&MockJobCreator{}, &MockS3Client{}, newTestRegistry(t), &MockBatchJobManager{})
+
+	body, _ := json.Marshal(types.RequestBody{
+		ID:             123,
+		User:           "test.user@example.com",
+		Path:           "/path/to/file.txt",
+		RetrievalType:  "Standard",
+		ConflictPolicy: "replace",
+	})
+	w := httptest.NewRecorder()
+	handler.CreateRestore(w, httptest.NewRequest("POST", "/restore", bytes.NewBuffer(body)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `Invalid conflict policy "replace"`) {
+		t.Errorf("Unexpected response body: %s", w.Body.String())
+	}
+}
+
+func TestStatsRejectsInvalidFilter(t *testing.T) {
+	handler := NewRestoreHandler(&MockJobCreator{}, &MockS3Client{}, newTestRegistry(t), &MockBatchJobManager{})
+
+	body, _ := json.Marshal(types.RequestBody{
+		ID:            123,
+		User:          "test.user@example.com",
+		Path:          "/path/to/file.txt",
+		RetrievalType: "Standard",
+		Filter:        types.FileFilter{Include: []string{"Proxies/["}},
+	})
+	w := httptest.NewRecorder()
+	handler.GetStatus(w, httptest.NewRequest("POST", "/stats", bytes.NewBuffer(body)))
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %d, got %d", http.StatusBadRequest, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), `Invalid filter: invalid pattern "Proxies/["`) {
+		t.Errorf("Unexpected response body: %s", w.Body.String())
+	}
+}
+
 func TestGetAWSAssetPath(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -258,6 +316,20 @@ func TestGetAWSAssetPath(t *testing.T) {
 	}
 }
 
+func TestGetAWSAssetKeys(t *testing.T) {
+	files := []string{
+		"/srv/Multimedia2/Project/Assets/Card A/A001.mov",
+		"/srv/Multimedia2/Project/Assets/Proxies/",
+		"/Card A/A002.mov",
+		"Card A/A003.mov",
+	}
+	want := []string{"Card A/A001.mov", "Proxies/", "Card A/A002.mov", "Card A/A003.mov"}
+
+	if got := GetAWSAssetKeys(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAWSAssetKeys() = %v, want %v", got, want)
+	}
+}
+
 func TestGetBasePath(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -276,3 +348,69 @@ func TestGetBasePath(t *testing.T) {
 		})
 	}
 }
+
+func TestRestoreWithAllFilesPresent(t *testing.T) {
+	projectPath := filepath.Join(t.TempDir(), "Assets", "Project")
+	if err := os.MkdirAll(projectPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(projectPath, "clip.mov"), []byte("clip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("ASSET_BUCKET_LIST", "test-bucket")
+	s3Client := &MockS3Client{
+		ListObjectsV2Func: func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			return &s3.ListObjectsV2Output{
+				Contents:    []s3Types.Object{{Key: aws.String("Project/clip.mov"), Size: aws.Int64(4)}},
+				IsTruncated: aws.Bool(false),
+			}, nil
+		},
+	}
+	repo := newTestRegistry(t)
+	jobCreator := &MockJobCreator{}
+	handler := NewRestoreHandler(jobCreator, s3Client, repo, &MockBatchJobManager{})
+	body, _ := json.Marshal(types.RequestBody{
+		ID:            123,
+		User:          "test.user@example.com",
+		Path:          projectPath,
+		RetrievalType: "Standard",
+	})
+
+	// The stats report that nothing needs restoring
+	w := httptest.NewRecorder()
+	handler.GetStatus(w, httptest.NewRequest("POST", "/stats", bytes.NewBuffer(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var stats map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats["presentFileCount"] != float64(1) || stats["numberOfFiles"] != float64(0) || stats["summary"] != "1 files already present, 0 to restore" {
+		t.Errorf("Unexpected stats: %v", stats)
+	}
+
+	// Nothing is started and the request isn't recorded as failed
+	w = httptest.NewRecorder()
+	handler.CreateRestore(w, httptest.NewRequest("POST", "/restore", bytes.NewBuffer(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d: %s", http.StatusOK, w.Code, w.Body.String())
+	}
+	var response types.RestoreResponse
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if response.PresentFileCount != 1 || response.FileCount != 0 {
+		t.Errorf("Unexpected response: %+v", response)
+	}
+	if jobCreator.createCalled {
+		t.Error("Expected no restore job to be created")
+	}
+	record, err := repo.Get(response.JobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.State != types.RestoreStateCompleted {
+		t.Errorf("Expected state %q, got %q", types.RestoreStateCompleted, record.State)
+	}
+}
@@ -8,11 +8,14 @@ import (
 	"net/http"
 	"os"
 	"pluto-restore-assets/cmd/api/handlers"
+	"pluto-restore-assets/internal/registry"
+	"pluto-restore-assets/internal/s3utils"
 	"pluto-restore-assets/pkg/kubernetes"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
 )
 
 func main() {
@@ -34,19 +37,58 @@ func main() {
 	}
 	s3Client := s3.NewFromConfig(cfg)
 
+	accountID, err := s3utils.GetAWSAccountID()
+	if err != nil {
+		log.Fatalf("Failed to get AWS account ID: %v", err)
+	}
+	batchJobs := s3utils.NewBatchJobManager(s3control.NewFromConfig(cfg), accountID, os.Getenv("MANIFEST_BUCKET"))
+
+	// Open the restore registry
+	registryPath := os.Getenv("REGISTRY_DB_PATH")
+	if registryPath == "" {
+		registryPath = "/data/restores.db"
+	}
+	restoreRegistry, err := registry.NewBoltRepository(registryPath)
+	if err != nil {
+		log.Fatalf("Failed to open restore registry: %v", err)
+	}
+	defer restoreRegistry.Close()
+
 	// Create handlers
-	restoreHandler := handlers.NewRestoreHandler(jobCreator, s3Client)
+	restoreHandler := handlers.NewRestoreHandler(jobCreator, s3Client, restoreRegistry, batchJobs)
 
 	// Setup routes
 	mux := http.NewServeMux()
 
 	// API routes
 	mux.HandleFunc("POST /restore", restoreHandler.CreateRestore)
+	mux.HandleFunc("GET /restore/{id}", restoreHandler.GetRestore)
+	mux.HandleFunc("DELETE /restore/{id}", restoreHandler.CancelRestore)
+	mux.HandleFunc("GET /restores", restoreHandler.ListRestores)
 	mux.HandleFunc("POST /stats", restoreHandler.GetStatus)
+	mux.HandleFunc("POST /stats/files", restoreHandler.PreviewFiles)
 	mux.HandleFunc("GET /health", healthHandler)
 	mux.HandleFunc("POST /notify", restoreHandler.Notify)
 	mux.HandleFunc("POST /permissions", restoreHandler.Permissions)
 
+	// Worker callbacks get their own port, exposed only by the cluster-internal
+	// Service, so they can't be reached through the ingress
+	internalMux := http.NewServeMux()
+	internalMux.HandleFunc("POST /internal/restore/{id}/progress", restoreHandler.ReportProgress)
+	internalMux.HandleFunc("GET /internal/restore/{id}", restoreHandler.GetRestore)
+	internalMux.HandleFunc("GET /health", healthHandler)
+
+	internalServer := &http.Server{
+		Addr:    ":9001",
+		Handler: LoggingMiddleware(internalMux),
+	}
+	go func() {
+		log.Println("Starting internal server on port 9001...")
+		if err := internalServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Internal server failed to start: %v", err)
+		}
+	}()
+
 	// Add logging middleware
 	handler := LoggingMiddleware(mux)
 
@@ -3,22 +3,37 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"pluto-restore-assets/internal/diskspace"
 	"pluto-restore-assets/internal/notification"
+	"pluto-restore-assets/internal/progress"
 	"pluto-restore-assets/internal/s3utils"
 	types "pluto-restore-assets/internal/types"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/cenkalti/backoff/v4"
 )
 
+// Files failing verification are kept on the multimedia volume, outside any project
+const defaultQuarantinePath = "/srv/Multimedia2/.restore-quarantine"
+
+const staleTempFileAge = time.Hour
+
 func main() {
 	log.Println("Starting restore worker")
 
@@ -31,7 +46,13 @@ func main() {
 	os.Setenv("AWS_SECRET_ACCESS_KEY", params.AWS_SECRET_ACCESS_KEY)
 	os.Setenv("AWS_DEFAULT_REGION", params.AWS_DEFAULT_REGION)
 
-	ctx := context.Background()
+	// The API's local manifest path only exists in the API pod, so keep our own copy
+	params.ManifestLocalPath = filepath.Join(os.TempDir(), path.Base(params.ManifestKey))
+
+	// Kubernetes sends SIGTERM when the job is deleted or the pod is evicted
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
 		log.Fatalf("Unable to load SDK config: %v", err)
@@ -40,77 +61,232 @@ func main() {
 	s3Client := s3.NewFromConfig(cfg)
 	s3ControlClient := s3control.NewFromConfig(cfg)
 
-	if err := handleRestore(ctx, s3Client, s3ControlClient, params); err != nil {
+	reporter := progress.NewReporter(params.ProgressURL, params.RestoreID)
+
+	// Downloads in progress keep writing to their temporary files, so anything idle
+	// for this long was left behind by a worker that crashed
+	if removed, err := s3utils.CleanupTempFiles(params.BasePath, staleTempFileAge); err != nil {
+		log.Printf("Error cleaning up temporary files: %v", err)
+	} else if removed > 0 {
+		log.Printf("Removed %d stale temporary files", removed)
+	}
+
+	// Restore events from SQS replace most of the HeadObject polling when a queue is configured
+	var monitor s3utils.RestoreMonitor = s3utils.NewPollingMonitor(s3Client, monitorOptions(params))
+	if params.RestoreEventQueueURL != "" {
+		monitor = s3utils.NewEventMonitor(sqs.NewFromConfig(cfg), params.RestoreEventQueueURL, s3Client, monitorOptions(params))
+	}
+
+	if err := handleRestore(ctx, s3Client, s3ControlClient, monitor, params, reporter); err != nil {
+		if ctx.Err() != nil {
+			log.Fatalf("Restore stopped by signal: %v", err)
+		}
+		reporter.Report(context.Background(), types.ProgressUpdate{
+			Phase:   types.RestorePhaseFailed,
+			Message: err.Error(),
+		})
 		log.Fatalf("Restore operation failed: %v", err)
 	}
 
 	log.Println("Restore worker completed successfully")
 }
 
-func handleRestore(ctx context.Context, s3Client *s3.Client, s3ControlClient *s3control.Client, params types.RestoreParams) error {
+func handleRestore(ctx context.Context, s3Client *s3.Client, s3ControlClient *s3control.Client, monitor s3utils.RestoreMonitor, params types.RestoreParams, reporter *progress.Reporter) error {
 	log.Println("handleRestore function called")
 
-	// Download manifest from S3 first
-	if err := downloadManifest(ctx, s3Client, params); err != nil {
+	// Download manifests from S3 first
+	if err := downloadManifest(ctx, s3Client, params.ManifestBucket, params.ManifestKey, params.ManifestLocalPath); err != nil {
 		return fmt.Errorf("failed to download manifest: %w", err)
 	}
+	var availableKeys []s3utils.S3Entry
+	if params.AvailableManifestKey != "" {
+		params.AvailableLocalPath = filepath.Join(os.TempDir(), path.Base(params.AvailableManifestKey))
+		if err := downloadManifest(ctx, s3Client, params.ManifestBucket, params.AvailableManifestKey, params.AvailableLocalPath); err != nil {
+			return fmt.Errorf("failed to download available manifest: %w", err)
+		}
+		var err error
+		if availableKeys, err = s3utils.LoadManifest(params.AvailableLocalPath); err != nil {
+			return err
+		}
+	}
+	restoreKeys, err := s3utils.LoadManifest(params.ManifestLocalPath)
+	if err != nil {
+		return err
+	}
+	reporter.Report(ctx, types.ProgressUpdate{Phase: types.RestorePhaseManifestDownloaded})
 
-	jobID, err := initiateRestore(ctx, s3Client, s3ControlClient, params)
+	// A previous pod for this restore may already have created the batch job and downloaded some files
+	checkpoint, err := s3utils.LoadCheckpoint(ctx, s3Client, params.ManifestBucket, params.ManifestKey)
 	if err != nil {
-		return fmt.Errorf("initiate restore: %w", err)
+		return fmt.Errorf("load checkpoint: %w", err)
 	}
+	previouslyDownloaded := len(checkpoint.Downloaded)
 
-	log.Printf("S3 Batch Restore initiated with job ID: %s", jobID)
+	// Refuse to start, before the batch job incurs any restore cost, if the restore
+	// would fill the volume
+	totalFiles := len(restoreKeys) + len(availableKeys)
+	pendingFiles := len(checkpoint.Pending(restoreKeys)) + len(checkpoint.Pending(availableKeys))
+	if err := checkFreeSpace(params, pendingFiles, totalFiles); err != nil {
+		report := s3utils.NewReport(params.RestoreID, params.ProjectId, time.Now(), nil)
+		report.PreviouslyDownloaded = previouslyDownloaded
+		if err := sendNotification(params, report, err); err != nil {
+			log.Printf("Failed to send failure notification: %v", err)
+		}
+		return err
+	}
+
+	onFileDone := downloadProgress(totalFiles-pendingFiles, totalFiles, reporter.Progress(ctx, types.RestorePhaseFilesDownloaded))
+
+	restoreCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Each downloaded file is added to the checkpoint as it finishes, rather than
+	// when its pool does, so a killed worker doesn't lose per-file progress
+	recorder := s3utils.NewCheckpointRecorder(checkpoint, func(checkpoint *s3utils.Checkpoint) {
+		saveCheckpoint(s3Client, params, checkpoint)
+	})
 
-	if keys, err := s3utils.MonitorObjectRestoreStatus(ctx, s3Client); err != nil {
-		return fmt.Errorf("monitor restore: %w", err)
-	} else {
-		if err := s3utils.DownloadFiles(ctx, s3Client, keys, params.BasePath, params.FileOwnerUID, params.FileOwnerGID); err != nil {
-			return fmt.Errorf("download files: %w", err)
+	// Objects that don't need thawing are downloaded while the archived ones are
+	// restored, with both pools sharing the bandwidth limit
+	opts := downloadOptions(params)
+	opts.OnResult = recorder.Record
+	startedAt := time.Now()
+	availableResult := make(chan downloadOutcome, 1)
+	go func() {
+		pending := pendingDownloads(recorder, availableKeys)
+		results, err := s3utils.DownloadFiles(restoreCtx, s3Client, pending, opts, onFileDone)
+		availableResult <- downloadOutcome{results: results, err: err}
+	}()
+
+	archived, restoreErr := restoreArchivedFiles(restoreCtx, s3Client, s3ControlClient, monitor, params, opts, reporter, recorder, restoreKeys, onFileDone)
+	if restoreErr != nil {
+		cancel()
+	}
+
+	available := <-availableResult
+	recorder.Save()
+
+	report := s3utils.NewReport(params.RestoreID, params.ProjectId, startedAt, append(available.results, archived...))
+	report.PreviouslyDownloaded = previouslyDownloaded
+	uploadReport(s3Client, params, report)
+
+	if restoreErr == nil && available.err != nil {
+		restoreErr = fmt.Errorf("download available files: %w", available.err)
+	}
+	if restoreErr != nil {
+		if errors.Is(restoreErr, context.Canceled) {
+			removePartialsIfCancelled(reporter, opts, restoreKeys, availableKeys)
 		}
+		if err := sendNotification(params, report, restoreErr); err != nil {
+			log.Printf("Failed to send failure notification: %v", err)
+		}
+		return restoreErr
 	}
 
-	log.Println("Restore process completed")
+	log.Printf("Restore process completed: %d succeeded, %d skipped, %d failed", report.Succeeded, report.Skipped, report.Failed)
 
+	if err := sendNotification(params, report, nil); err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	reporter.Report(ctx, types.ProgressUpdate{Phase: types.RestorePhaseNotificationSent})
+
+	if report.Failed > 0 {
+		return fmt.Errorf("%d of %d files failed to download", report.Failed, len(report.Files))
+	}
+	return nil
+}
+
+// maxFailuresInNotification keeps notification emails readable for large failures;
+// the full list is in the report.
+const maxFailuresInNotification = 20
+
+// sendNotification emails the outcome of the restore. restoreErr is set when the
+// restore itself failed or was stopped, rather than individual files.
+func sendNotification(params types.RestoreParams, report *s3utils.Report, restoreErr error) error {
 	emailSender := notification.NewSMTPEmailSender(
 		params.SMTPHost,
 		params.SMTPPort,
 		params.SMTPFrom,
 		params.NotificationEmail,
 	)
-	subject := fmt.Sprintf("Asset Restore Completed for Project %d", params.ProjectId)
+
+	outcome := "Completed"
+	switch {
+	case errors.Is(restoreErr, context.Canceled):
+		outcome = "Stopped"
+	case restoreErr != nil, report.Failed > 0 && report.Succeeded+report.Skipped+report.PreviouslyDownloaded == 0:
+		outcome = "Failed"
+	case report.Failed > 0:
+		outcome = "Partially Completed"
+	}
+
+	subject := fmt.Sprintf("Asset Restore %s for Project %d", outcome, params.ProjectId)
 	emailBody := fmt.Sprintf(
-		"Project Asset Restore Completed.\n\n"+
+		"Project Asset Restore %s.\n\n"+
 			"User requesting restore: %v\n"+
 			"Retrieval Type: %v\n"+
-			"Project URL: %v%v",
+			"Project URL: %v%v\n\n"+
+			"Files restored: %d (%.2f GB)\n"+
+			"Files skipped: %d\n"+
+			"Files failed: %d (%d with unsafe names)\n",
+		outcome,
 		params.User,
 		params.RetrievalType,
 		params.PlutoProjectURL,
 		params.ProjectId,
+		report.Succeeded+report.PreviouslyDownloaded,
+		gigabytes(report.Bytes),
+		report.Skipped,
+		report.Failed,
+		report.Rejected,
 	)
+	if restoreErr != nil {
+		emailBody += fmt.Sprintf("\nThe restore did not finish: %v\n", restoreErr)
+		if outcome == "Stopped" {
+			emailBody += "If it wasn't cancelled, a new worker continues with the files still missing.\n"
+		}
+	}
+	if report.Failed > 0 {
+		var b strings.Builder
+		b.WriteString("\nFailed files:\n")
+		for i, file := range report.FailedFiles() {
+			if i == maxFailuresInNotification {
+				fmt.Fprintf(&b, "... and %d more\n", report.Failed-i)
+				break
+			}
+			fmt.Fprintf(&b, "• %s: %s\n", file.Key, file.Error)
+		}
+		fmt.Fprintf(&b, "\nFull report: s3://%s/%s\n", params.ManifestBucket, s3utils.ReportKey(params.ManifestKey, "csv"))
+		emailBody += b.String()
+	}
 
 	log.Printf("Attempting to send email using SMTP server: %s:%s", params.SMTPHost, params.SMTPPort)
-	err = emailSender.SendEmail(subject, emailBody)
+	return emailSender.SendEmail(subject, emailBody)
+}
 
-	if err != nil {
-		return fmt.Errorf("failed to send notification: %w", err)
+// uploadReport stores the report next to the manifest. Like checkpoints it is
+// uploaded even when the worker is stopping.
+func uploadReport(s3Client *s3.Client, params types.RestoreParams, report *s3utils.Report) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := s3utils.UploadReport(ctx, s3Client, params.ManifestBucket, params.ManifestKey, report); err != nil {
+		log.Printf("Error uploading restore report: %v", err)
+		return
 	}
-
-	return nil
+	log.Printf("Uploaded restore report to s3://%s/%s", params.ManifestBucket, s3utils.ReportKey(params.ManifestKey, "json"))
 }
 
-func downloadManifest(ctx context.Context, s3Client *s3.Client, params types.RestoreParams) error {
+func downloadManifest(ctx context.Context, s3Client *s3.Client, bucket, key, localPath string) error {
 	result, err := s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(params.ManifestBucket),
-		Key:    aws.String(params.ManifestKey),
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
 	})
 	if err != nil {
 		return fmt.Errorf("failed to get manifest from S3: %w", err)
 	}
 	defer result.Body.Close()
 
-	file, err := os.Create(params.ManifestLocalPath)
+	file, err := os.Create(localPath)
 	if err != nil {
 		return fmt.Errorf("failed to create local manifest file: %w", err)
 	}
@@ -123,13 +299,209 @@ func downloadManifest(ctx context.Context, s3Client *s3.Client, params types.Res
 	return nil
 }
 
-func initiateRestore(ctx context.Context, s3Client *s3.Client, s3ControlClient *s3control.Client, params types.RestoreParams) (string, error) {
+// downloadProgress returns the callback both download pools report each finished
+// file to. Files downloaded by earlier workers count as done, so a resumed
+// restore still reaches totalFiles.
+func downloadProgress(alreadyDownloaded, totalFiles int, onProgress s3utils.ProgressFunc) s3utils.ProgressFunc {
+	var downloaded atomic.Int64
+	downloaded.Store(int64(alreadyDownloaded))
+	return func(done, total int) {
+		onProgress(int(downloaded.Add(1)), totalFiles)
+	}
+}
+
+type downloadOutcome struct {
+	results []s3utils.FileResult
+	err     error
+}
+
+// restoreArchivedFiles runs the S3 Batch restore for archived objects, waits for
+// them to thaw and downloads them, returning the result of every download.
+func restoreArchivedFiles(ctx context.Context, s3Client *s3.Client, s3ControlClient *s3control.Client, monitor s3utils.RestoreMonitor, params types.RestoreParams, opts s3utils.DownloadOptions, reporter *progress.Reporter, recorder *s3utils.CheckpointRecorder, restoreKeys []s3utils.S3Entry, onFileDone s3utils.ProgressFunc) ([]s3utils.FileResult, error) {
+	if len(restoreKeys) == 0 {
+		log.Println("No archived objects to restore, skipping S3 Batch Restore")
+		return nil, nil
+	}
+
+	jobID, err := initiateRestore(ctx, s3Client, s3ControlClient, params, recorder.BatchJobID())
+	if err != nil {
+		return nil, fmt.Errorf("initiate restore: %w", err)
+	}
+
+	log.Printf("S3 Batch Restore initiated with job ID: %s", jobID)
+	reporter.Report(ctx, types.ProgressUpdate{Phase: types.RestorePhaseBatchJobCreated, BatchJobID: jobID})
+
+	recorder.SetBatchJobID(jobID)
+
+	pending := pendingDownloads(recorder, restoreKeys)
+	return downloadRestored(ctx, s3Client, monitor, pending, opts, reporter.Progress(ctx, types.RestorePhaseObjectsThawed), onFileDone)
+}
+
+// downloadRestored downloads pending objects as soon as the monitor reports them
+// restored. The monitor is stopped once the downloads end, so it can't block
+// forever sending to a pool that stopped early.
+func downloadRestored(ctx context.Context, s3Client *s3.Client, monitor s3utils.RestoreMonitor, pending []s3utils.S3Entry, opts s3utils.DownloadOptions, onThawed, onFileDone s3utils.ProgressFunc) ([]s3utils.FileResult, error) {
+	monitorCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	restored := make(chan s3utils.S3Entry)
+	monitorErr := make(chan error, 1)
+	go func() {
+		monitorErr <- monitor.Monitor(monitorCtx, pending, restored, onThawed)
+	}()
+
+	results, err := s3utils.DownloadStream(ctx, s3Client, restored, len(pending), opts, onFileDone)
+	cancel()
+	// The monitor was stopped because the downloads failed, so report that first
+	if err != nil {
+		<-monitorErr
+		return results, fmt.Errorf("download files: %w", err)
+	}
+	if err := <-monitorErr; err != nil {
+		return results, fmt.Errorf("monitor restore: %w", err)
+	}
+	return results, nil
+}
+
+func downloadOptions(params types.RestoreParams) s3utils.DownloadOptions {
+	quarantinePath := params.QuarantinePath
+	if quarantinePath == "" {
+		quarantinePath = defaultQuarantinePath
+	}
+	escaping := s3utils.KeyEscaping(params.KeyEscaping)
+	if !escaping.Valid() {
+		log.Printf("Ignoring unknown key escaping %q, replacing invalid characters", params.KeyEscaping)
+		escaping = s3utils.KeyEscapingReplace
+	}
+	return s3utils.DownloadOptions{
+		BasePath:           params.BasePath,
+		FileOwnerUID:       params.FileOwnerUID,
+		FileOwnerGID:       params.FileOwnerGID,
+		QuarantinePath:     filepath.Join(quarantinePath, params.RestoreID),
+		ConflictPolicy:     types.ConflictPolicy(params.ConflictPolicy),
+		Workers:            params.DownloadWorkers,
+		PartConcurrency:    params.PartConcurrency,
+		PartSize:           int64(params.PartSizeMB) << 20,
+		Limiter:            bandwidthLimiter(params),
+		MinFreeBytes:       diskspace.Headroom(params.FreeSpaceHeadroomGB),
+		PreserveAttributes: params.PreserveAttributes,
+		KeyEscaping:        escaping,
+	}
+}
+
+// checkFreeSpace returns an error if the files still to download would leave
+// less than the headroom free on the destination volume. Files downloaded by a
+// previous worker are assumed to be of average size.
+func checkFreeSpace(params types.RestoreParams, pendingFiles, totalFiles int) error {
+	if totalFiles == 0 || params.TotalSize == 0 {
+		return nil
+	}
+	remaining := params.TotalSize * int64(pendingFiles) / int64(totalFiles)
+	estimate, err := diskspace.Check(params.BasePath, remaining, diskspace.Headroom(params.FreeSpaceHeadroomGB))
+	if err != nil {
+		log.Printf("Skipping free space check: %v", err)
+		return nil
+	}
+	log.Printf("%.2f GB free on %s, %.2f GB needed including headroom", gigabytes(estimate.Free), params.BasePath, gigabytes(estimate.Required))
+	if !estimate.Fits {
+		return fmt.Errorf("not enough free space on %s: %.2f GB free, %.2f GB needed including headroom", params.BasePath, gigabytes(estimate.Free), gigabytes(estimate.Required))
+	}
+	return nil
+}
+
+func gigabytes(bytes int64) float64 {
+	return float64(bytes) / (1024 * 1024 * 1024)
+}
+
+// bandwidthLimiter returns the limiter shared by all downloads, or nil when
+// bandwidth is unlimited. The schedule is in the worker's local time zone.
+func bandwidthLimiter(params types.RestoreParams) *s3utils.BandwidthLimiter {
+	if params.BandwidthLimitMB <= 0 {
+		return nil
+	}
+	var window *s3utils.ThrottleWindow
+	if params.BandwidthSchedule != "" {
+		w, err := s3utils.ParseThrottleWindow(params.BandwidthSchedule)
+		if err != nil {
+			log.Printf("Ignoring bandwidth schedule, throttling all day: %v", err)
+		} else {
+			window = &w
+		}
+	}
+	log.Printf("Limiting downloads to %d MB/s (schedule: %q)", params.BandwidthLimitMB, params.BandwidthSchedule)
+	return s3utils.NewBandwidthLimiter(int64(params.BandwidthLimitMB)<<20, window)
+}
+
+func monitorOptions(params types.RestoreParams) s3utils.MonitorOptions {
+	opts := s3utils.MonitorOptions{
+		Workers:        params.PollWorkers,
+		HeadObjectRate: params.HeadObjectRate,
+		PollInterval:   s3utils.DefaultPollInterval(params.RetrievalType),
+	}
+	if params.PollInterval != "" {
+		interval, err := time.ParseDuration(params.PollInterval)
+		if err != nil || interval <= 0 {
+			log.Printf("Ignoring invalid poll interval %q, using %v", params.PollInterval, opts.PollInterval)
+		} else {
+			opts.PollInterval = interval
+		}
+	}
+	return opts
+}
+
+func pendingDownloads(recorder *s3utils.CheckpointRecorder, keys []s3utils.S3Entry) []s3utils.S3Entry {
+	pending := recorder.Pending(keys)
+	if len(pending) < len(keys) {
+		log.Printf("Skipping %d files downloaded by a previous worker", len(keys)-len(pending))
+	}
+	return pending
+}
+
+// removePartialsIfCancelled removes the partial downloads kept for resuming when
+// the worker was stopped because a user cancelled the restore. A worker that was
+// evicted keeps them for its replacement.
+func removePartialsIfCancelled(reporter *progress.Reporter, opts s3utils.DownloadOptions, keys ...[]s3utils.S3Entry) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cancelled, err := reporter.Cancelled(ctx)
+	if err != nil {
+		log.Printf("Keeping partial downloads, failed to check whether the restore was cancelled: %v", err)
+		return
+	}
+	if !cancelled {
+		return
+	}
+	removed := 0
+	for _, entries := range keys {
+		removed += s3utils.RemovePartialDownloads(entries, opts)
+	}
+	log.Printf("Restore was cancelled, removed %d partial downloads", removed)
+}
+
+// saveCheckpoint persists progress so a replacement pod can resume. It uses its
+// own context so progress is still saved while the worker is being terminated.
+func saveCheckpoint(s3Client *s3.Client, params types.RestoreParams, checkpoint *s3utils.Checkpoint) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := s3utils.SaveCheckpoint(ctx, s3Client, params.ManifestBucket, params.ManifestKey, checkpoint); err != nil {
+		log.Printf("Failed to save checkpoint: %v", err)
+	}
+}
+
+func initiateRestore(ctx context.Context, s3Client *s3.Client, s3ControlClient *s3control.Client, params types.RestoreParams, checkpointJobID string) (string, error) {
 
 	accountID, manifestETag, err := getRestoreDetails(ctx, s3Client, params)
 	if err != nil {
 		return "", err
 	}
 
+	if jobID := findExistingBatchJob(ctx, s3ControlClient, accountID, params, checkpointJobID); jobID != "" {
+		log.Printf("Resuming existing S3 Batch Restore job %s", jobID)
+		return jobID, nil
+	}
+
 	jobID, err := s3utils.InitiateS3BatchRestore(ctx, s3Client, *s3ControlClient, accountID, params, manifestETag)
 	if err != nil {
 		log.Printf("Failed to initiate S3 Batch Restore: %v", err)
@@ -139,6 +511,34 @@ func initiateRestore(ctx context.Context, s3Client *s3.Client, s3ControlClient *
 	return jobID, nil
 }
 
+// findExistingBatchJob returns the ID of a usable batch job created earlier for
+// this manifest, or an empty string if a new one has to be created. jobID is the
+// batch job recorded in the checkpoint, if any.
+func findExistingBatchJob(ctx context.Context, s3ControlClient *s3control.Client, accountID string, params types.RestoreParams, jobID string) string {
+	if jobID == "" {
+		var err error
+		jobID, err = s3utils.FindBatchJobForManifest(ctx, s3ControlClient, accountID, params.ManifestBucket, params.ManifestKey)
+		if err != nil {
+			log.Printf("Failed to look for an existing batch job, creating a new one: %v", err)
+			return ""
+		}
+		if jobID == "" {
+			return ""
+		}
+	}
+
+	usable, err := s3utils.ResumeS3BatchJob(ctx, s3ControlClient, accountID, jobID)
+	if err != nil {
+		log.Printf("Failed to resume batch job %s, creating a new one: %v", jobID, err)
+		return ""
+	}
+	if !usable {
+		log.Printf("Batch job %s can no longer be used, creating a new one", jobID)
+		return ""
+	}
+	return jobID
+}
+
 func getRestoreDetails(ctx context.Context, s3Client *s3.Client, params types.RestoreParams) (string, string, error) {
 	accountID, err := s3utils.GetAWSAccountID()
 	if err != nil {
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pluto-restore-assets/internal/s3utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeMonitor reports every key restored straight away.
+type fakeMonitor struct{}
+
+func (fakeMonitor) Monitor(ctx context.Context, keys []s3utils.S3Entry, restored chan<- s3utils.S3Entry, onProgress s3utils.ProgressFunc) error {
+	defer close(restored)
+	for _, key := range keys {
+		select {
+		case restored <- key:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func TestDownloadRestoredStopsMonitorWhenDownloadsFail(t *testing.T) {
+	// A base path below a regular file can't be created, so the pool never starts
+	file := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(file, nil, 0644))
+	opts := s3utils.DownloadOptions{BasePath: filepath.Join(file, "Project")}
+	pending := []s3utils.S3Entry{{Bucket: "bucket1", Key: "a.mov"}, {Bucket: "bucket1", Key: "b.mov"}}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := downloadRestored(context.Background(), nil, fakeMonitor{}, pending, opts, nil, nil)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		assert.ErrorContains(t, err, "download files")
+	case <-time.After(5 * time.Second):
+		t.Fatal("downloadRestored did not return after the downloads failed")
+	}
+}
+
+func TestDownloadProgressCountsEarlierWorkers(t *testing.T) {
+	var updates [][2]int
+	onFileDone := downloadProgress(900, 1000, func(done, total int) {
+		updates = append(updates, [2]int{done, total})
+	})
+
+	// Each pool counts its own files, but the restore counts all of them
+	for i := 1; i <= 60; i++ {
+		onFileDone(i, 60)
+	}
+	for i := 1; i <= 40; i++ {
+		onFileDone(i, 40)
+	}
+	require.Len(t, updates, 100)
+	assert.Equal(t, [2]int{901, 1000}, updates[0])
+	assert.Equal(t, [2]int{1000, 1000}, updates[99])
+}
@@ -0,0 +1,89 @@
+package diskspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// DefaultHeadroom is the space left free on the volume for everyone else's work
+// when no headroom is configured.
+const DefaultHeadroom = 50 << 30
+
+// Headroom converts a configured headroom in GiB to bytes, using the default if
+// it isn't set.
+func Headroom(gb int) int64 {
+	if gb <= 0 {
+		return DefaultHeadroom
+	}
+	return int64(gb) << 30
+}
+
+// Free returns the bytes available to unprivileged users on the filesystem
+// holding path. A path that doesn't exist yet is measured on its nearest
+// existing parent.
+func Free(path string) (int64, error) {
+	path = filepath.Clean(path)
+	for {
+		var stat syscall.Statfs_t
+		err := syscall.Statfs(path, &stat)
+		if err == nil {
+			return int64(stat.Bavail) * int64(stat.Bsize), nil
+		}
+		parent := filepath.Dir(path)
+		if !errors.Is(err, fs.ErrNotExist) || parent == path {
+			return 0, fmt.Errorf("failed to get free space of %s: %w", path, err)
+		}
+		path = parent
+	}
+}
+
+// Estimate describes whether a restore fits on the destination volume.
+type Estimate struct {
+	Free     int64 `json:"free"`
+	Required int64 `json:"required"` // size of the restore plus headroom
+	Fits     bool  `json:"fits"`
+}
+
+// Check reports whether size bytes can be written to path while still leaving
+// headroom bytes free.
+func Check(path string, size, headroom int64) (Estimate, error) {
+	free, err := Free(path)
+	if err != nil {
+		return Estimate{}, err
+	}
+	required := size + headroom
+	return Estimate{Free: free, Required: required, Fits: free >= required}, nil
+}
+
+// WaitForSpace blocks until at least needed bytes are free at path, checking
+// every interval, or until ctx is done.
+func WaitForSpace(ctx context.Context, path string, needed int64, interval time.Duration) error {
+	paused := false
+	for {
+		free, err := Free(path)
+		if err != nil {
+			return err
+		}
+		if free >= needed {
+			if paused {
+				log.Printf("Free space on %s recovered to %d bytes, resuming", path, free)
+			}
+			return nil
+		}
+		if !paused {
+			log.Printf("Only %d bytes free on %s, %d needed; pausing until space is freed", free, path, needed)
+			paused = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
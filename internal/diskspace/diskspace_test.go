@@ -0,0 +1,49 @@
+package diskspace
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFree(t *testing.T) {
+	dir := t.TempDir()
+	free, err := Free(dir)
+	assert.NoError(t, err)
+	assert.Positive(t, free)
+
+	// Project folders that haven't been created yet are measured on their parent
+	missing, err := Free(filepath.Join(dir, "Project", "Assets"))
+	assert.NoError(t, err)
+	assert.Positive(t, missing)
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+
+	estimate, err := Check(dir, 1024, 0)
+	assert.NoError(t, err)
+	assert.True(t, estimate.Fits)
+	assert.Equal(t, int64(1024), estimate.Required)
+
+	estimate, err = Check(dir, 1024, 1<<62)
+	assert.NoError(t, err)
+	assert.False(t, estimate.Fits)
+}
+
+func TestWaitForSpace(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, WaitForSpace(context.Background(), dir, 1, time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, WaitForSpace(ctx, dir, 1<<62, time.Millisecond), context.DeadlineExceeded)
+}
+
+func TestHeadroom(t *testing.T) {
+	assert.Equal(t, int64(DefaultHeadroom), Headroom(0))
+	assert.Equal(t, int64(10<<30), Headroom(10))
+}
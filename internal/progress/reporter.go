@@ -0,0 +1,134 @@
+package progress
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"pluto-restore-assets/internal/types"
+)
+
+// Reporter posts phase transitions from the worker back to the API. Reporting
+// is best effort: failures are logged and never abort the restore.
+type Reporter struct {
+	endpoint    string
+	recordURL   string
+	client      *http.Client
+	minInterval time.Duration
+
+	mu       sync.Mutex
+	lastSent map[types.RestorePhase]time.Time
+}
+
+// NewReporter returns a Reporter for the given restore. If baseURL or restoreID
+// is empty the returned Reporter discards every update.
+func NewReporter(baseURL, restoreID string) *Reporter {
+	if baseURL == "" || restoreID == "" {
+		log.Println("Progress reporting disabled: no API URL or restore ID")
+		return &Reporter{}
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return &Reporter{
+		endpoint:    fmt.Sprintf("%s/internal/restore/%s/progress", baseURL, restoreID),
+		recordURL:   fmt.Sprintf("%s/internal/restore/%s", baseURL, restoreID),
+		client:      &http.Client{Timeout: 10 * time.Second},
+		minInterval: 30 * time.Second,
+		lastSent:    make(map[types.RestorePhase]time.Time),
+	}
+}
+
+// Report sends an update to the API. Repeated counting updates for the same
+// phase are throttled, except for the final one where Done reaches Total.
+func (r *Reporter) Report(ctx context.Context, update types.ProgressUpdate) {
+	if r.endpoint == "" {
+		return
+	}
+	if update.Timestamp.IsZero() {
+		update.Timestamp = time.Now()
+	}
+	if r.throttled(update) {
+		return
+	}
+
+	if err := r.send(ctx, update); err != nil {
+		log.Printf("Failed to report progress %s: %v", update.Phase, err)
+	}
+}
+
+// Progress returns a callback suitable for the s3utils monitor and download
+// loops which reports counting updates for the given phase.
+func (r *Reporter) Progress(ctx context.Context, phase types.RestorePhase) func(done, total int) {
+	return func(done, total int) {
+		r.Report(ctx, types.ProgressUpdate{Phase: phase, Done: done, Total: total})
+	}
+}
+
+// Cancelled asks the API whether a user cancelled the restore, which the worker
+// can't otherwise tell apart from being evicted. It returns false when
+// reporting is disabled.
+func (r *Reporter) Cancelled(ctx context.Context) (bool, error) {
+	if r.recordURL == "" {
+		return false, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.recordURL, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to create restore request: %w", err)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to get restore: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected status from API: %s", resp.Status)
+	}
+	var record types.RestoreRecord
+	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+		return false, fmt.Errorf("failed to decode restore: %w", err)
+	}
+	return record.State == types.RestoreStateCancelled, nil
+}
+
+func (r *Reporter) throttled(update types.ProgressUpdate) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	final := update.Total == 0 || update.Done >= update.Total
+	if last, ok := r.lastSent[update.Phase]; ok && !final && update.Timestamp.Sub(last) < r.minInterval {
+		return true
+	}
+	r.lastSent[update.Phase] = update.Timestamp
+	return false
+}
+
+func (r *Reporter) send(ctx context.Context, update types.ProgressUpdate) error {
+	body, err := json.Marshal(update)
+	if err != nil {
+		return fmt.Errorf("failed to marshal progress update: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create progress request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post progress update: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status from API: %s", resp.Status)
+	}
+	return nil
+}
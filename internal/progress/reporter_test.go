@@ -0,0 +1,74 @@
+package progress
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"pluto-restore-assets/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReporter(t *testing.T) {
+	var mu sync.Mutex
+	var received []types.ProgressUpdate
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/internal/restore/abc/progress", r.URL.Path)
+		var update types.ProgressUpdate
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&update))
+		mu.Lock()
+		received = append(received, update)
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	reporter := NewReporter(server.URL+"/", "abc")
+	ctx := context.Background()
+
+	reporter.Report(ctx, types.ProgressUpdate{Phase: types.RestorePhaseBatchJobCreated, BatchJobID: "batch-1"})
+
+	// Intermediate counting updates are throttled, the final one always goes through
+	onProgress := reporter.Progress(ctx, types.RestorePhaseFilesDownloaded)
+	onProgress(1, 3)
+	onProgress(2, 3)
+	onProgress(3, 3)
+
+	assert.Len(t, received, 3)
+	assert.Equal(t, "batch-1", received[0].BatchJobID)
+	assert.Equal(t, 1, received[1].Done)
+	assert.Equal(t, 3, received[2].Done)
+	assert.False(t, received[2].Timestamp.IsZero())
+}
+
+func TestReporterCancelled(t *testing.T) {
+	state := types.RestoreStateRunning
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/internal/restore/abc", r.URL.Path)
+		json.NewEncoder(w).Encode(types.RestoreRecord{ID: "abc", State: state})
+	}))
+	defer server.Close()
+
+	reporter := NewReporter(server.URL, "abc")
+	cancelled, err := reporter.Cancelled(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+
+	state = types.RestoreStateCancelled
+	cancelled, err = reporter.Cancelled(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, cancelled)
+}
+
+func TestReporterDisabled(t *testing.T) {
+	reporter := NewReporter("", "abc")
+	// Must not panic or attempt any request
+	reporter.Report(context.Background(), types.ProgressUpdate{Phase: types.RestorePhaseFailed})
+	cancelled, err := reporter.Cancelled(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, cancelled)
+}
@@ -0,0 +1,135 @@
+package registry
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pluto-restore-assets/internal/types"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var restoresBucket = []byte("restores")
+
+type BoltRepository struct {
+	db *bolt.DB
+}
+
+func NewBoltRepository(path string) (*BoltRepository, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create registry directory: %w", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open registry database %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(restoresBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create registry bucket: %w", err)
+	}
+
+	return &BoltRepository{db: db}, nil
+}
+
+func (r *BoltRepository) Create(record *types.RestoreRecord) error {
+	now := time.Now()
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = now
+	}
+	record.UpdatedAt = now
+
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(restoresBucket)
+		if b.Get([]byte(record.ID)) != nil {
+			return fmt.Errorf("restore record %s already exists", record.ID)
+		}
+		return putRecord(b, record)
+	})
+}
+
+func (r *BoltRepository) Get(id string) (*types.RestoreRecord, error) {
+	var record *types.RestoreRecord
+	err := r.db.View(func(tx *bolt.Tx) error {
+		var err error
+		record, err = getRecord(tx.Bucket(restoresBucket), id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (r *BoltRepository) List(filter ListFilter) ([]*types.RestoreRecord, error) {
+	records := []*types.RestoreRecord{}
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(restoresBucket).ForEach(func(k, v []byte) error {
+			var record types.RestoreRecord
+			if err := json.Unmarshal(v, &record); err != nil {
+				return fmt.Errorf("failed to decode restore record %s: %w", k, err)
+			}
+			if filter.matches(&record) {
+				records = append(records, &record)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Most recent first
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.After(records[j].CreatedAt)
+	})
+	return records, nil
+}
+
+func (r *BoltRepository) Update(id string, fn func(record *types.RestoreRecord) error) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(restoresBucket)
+		record, err := getRecord(b, id)
+		if err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+		record.ID = id
+		record.UpdatedAt = time.Now()
+		return putRecord(b, record)
+	})
+}
+
+func (r *BoltRepository) Close() error {
+	return r.db.Close()
+}
+
+func getRecord(b *bolt.Bucket, id string) (*types.RestoreRecord, error) {
+	data := b.Get([]byte(id))
+	if data == nil {
+		return nil, ErrNotFound
+	}
+	var record types.RestoreRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to decode restore record %s: %w", id, err)
+	}
+	return &record, nil
+}
+
+func putRecord(b *bolt.Bucket, record *types.RestoreRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode restore record %s: %w", record.ID, err)
+	}
+	return b.Put([]byte(record.ID), data)
+}
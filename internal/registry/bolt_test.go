@@ -0,0 +1,87 @@
+package registry
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pluto-restore-assets/internal/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRepository(t *testing.T) *BoltRepository {
+	repo, err := NewBoltRepository(filepath.Join(t.TempDir(), "registry", "restores.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestBoltRepositoryCreateAndGet(t *testing.T) {
+	repo := newTestRepository(t)
+
+	err := repo.Create(&types.RestoreRecord{
+		ID:        "abc",
+		ProjectId: 1234,
+		User:      "test.user@example.com",
+		State:     types.RestoreStatePending,
+	})
+	assert.NoError(t, err)
+
+	record, err := repo.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, 1234, record.ProjectId)
+	assert.Equal(t, types.RestoreStatePending, record.State)
+	assert.False(t, record.CreatedAt.IsZero())
+
+	// Duplicate IDs are rejected
+	assert.Error(t, repo.Create(&types.RestoreRecord{ID: "abc"}))
+
+	_, err = repo.Get("missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestBoltRepositoryUpdate(t *testing.T) {
+	repo := newTestRepository(t)
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "abc", State: types.RestoreStatePending}))
+
+	err := repo.Update("abc", func(record *types.RestoreRecord) error {
+		record.JobName = "restore-job-1234-1"
+		record.State = types.RestoreStateJobCreated
+		return nil
+	})
+	assert.NoError(t, err)
+
+	record, err := repo.Get("abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "restore-job-1234-1", record.JobName)
+	assert.Equal(t, types.RestoreStateJobCreated, record.State)
+
+	err = repo.Update("missing", func(record *types.RestoreRecord) error { return nil })
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestBoltRepositoryList(t *testing.T) {
+	repo := newTestRepository(t)
+	now := time.Now()
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "1", ProjectId: 1, State: types.RestoreStateCompleted, CreatedAt: now.Add(-2 * time.Hour)}))
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "2", ProjectId: 2, State: types.RestoreStatePending, CreatedAt: now.Add(-1 * time.Hour)}))
+	assert.NoError(t, repo.Create(&types.RestoreRecord{ID: "3", ProjectId: 1, State: types.RestoreStatePending, CreatedAt: now}))
+
+	records, err := repo.List(ListFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, "3", records[0].ID)
+	assert.Equal(t, "1", records[2].ID)
+
+	records, err = repo.List(ListFilter{ProjectId: 1})
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	records, err = repo.List(ListFilter{ProjectId: 1, State: types.RestoreStatePending})
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "3", records[0].ID)
+}
@@ -0,0 +1,35 @@
+package registry
+
+import (
+	"errors"
+	"pluto-restore-assets/internal/types"
+)
+
+var ErrNotFound = errors.New("restore record not found")
+
+// ListFilter narrows the records returned by Repository.List. Zero values match everything.
+type ListFilter struct {
+	ProjectId int
+	State     types.RestoreState
+}
+
+// Repository stores restore requests so their progress can be queried after the
+// request that created them has returned.
+type Repository interface {
+	Create(record *types.RestoreRecord) error
+	Get(id string) (*types.RestoreRecord, error)
+	List(filter ListFilter) ([]*types.RestoreRecord, error)
+	// Update loads the record, applies fn to it and saves the result atomically.
+	Update(id string, fn func(record *types.RestoreRecord) error) error
+	Close() error
+}
+
+func (f ListFilter) matches(record *types.RestoreRecord) bool {
+	if f.ProjectId != 0 && record.ProjectId != f.ProjectId {
+		return false
+	}
+	if f.State != "" && record.State != f.State {
+		return false
+	}
+	return true
+}
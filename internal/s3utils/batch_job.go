@@ -62,7 +62,7 @@ func InitiateS3BatchRestore(ctx context.Context, s3Client *s3.Client, s3ControlC
 		RoleArn: aws.String(params.RoleArn),
 	}
 
-	result, err := s3ControlClient.CreateJob(context.TODO(), jobInput)
+	result, err := s3ControlClient.CreateJob(ctx, jobInput)
 	if err != nil {
 		var ae smithy.APIError
 		if errors.As(err, &ae) {
@@ -73,7 +73,7 @@ func InitiateS3BatchRestore(ctx context.Context, s3Client *s3.Client, s3ControlC
 					return "", fmt.Errorf("failed to get current ETag: %w", err)
 				}
 				jobInput.Manifest.Location.ETag = aws.String(currentETag)
-				result, err = s3ControlClient.CreateJob(context.TODO(), jobInput)
+				result, err = s3ControlClient.CreateJob(ctx, jobInput)
 				if err != nil {
 					return "", fmt.Errorf("failed to create S3 Batch Operations job with updated ETag: %w", err)
 				}
@@ -88,7 +88,7 @@ func InitiateS3BatchRestore(ctx context.Context, s3Client *s3.Client, s3ControlC
 	jobID := aws.ToString(result.JobId)
 	log.Printf("S3 Batch Operations job created. Job ID: %s", jobID)
 	// Wait for the job to be in a state where we can update it
-	err = waitForJobReadyToUpdate(&s3ControlClient, accountID, jobID)
+	err = waitForJobReadyToUpdate(ctx, &s3ControlClient, accountID, jobID)
 	if err != nil {
 		log.Printf("Failed to wait for job to be ready: %v", err)
 		return "", fmt.Errorf("failed to wait for job to be ready: %w", err)
@@ -101,7 +101,7 @@ func InitiateS3BatchRestore(ctx context.Context, s3Client *s3.Client, s3ControlC
 		RequestedJobStatus: types.RequestedJobStatusReady,
 	}
 
-	_, err = s3ControlClient.UpdateJobStatus(context.TODO(), updateInput)
+	_, err = s3ControlClient.UpdateJobStatus(ctx, updateInput)
 	if err != nil {
 		log.Printf("Failed to start S3 Batch Operations job: %v", err)
 		return "", fmt.Errorf("failed to start S3 Batch Operations job: %w", err)
@@ -112,7 +112,7 @@ func InitiateS3BatchRestore(ctx context.Context, s3Client *s3.Client, s3ControlC
 	return jobID, nil
 }
 
-func waitForJobReadyToUpdate(client *s3control.Client, accountID, jobID string) error {
+func waitForJobReadyToUpdate(ctx context.Context, client *s3control.Client, accountID, jobID string) error {
 	maxAttempts := 60
 	backoff := time.Second
 
@@ -122,7 +122,7 @@ func waitForJobReadyToUpdate(client *s3control.Client, accountID, jobID string)
 			JobId:     aws.String(jobID),
 		}
 
-		describeOutput, err := client.DescribeJob(context.TODO(), describeInput)
+		describeOutput, err := client.DescribeJob(ctx, describeInput)
 		if err != nil {
 			log.Printf("Failed to describe job: %v", err)
 			return fmt.Errorf("failed to describe job: %w", err)
@@ -147,7 +147,11 @@ func waitForJobReadyToUpdate(client *s3control.Client, accountID, jobID string)
 		log.Printf("Waiting for job to be ready for update. Attempt %d/%d. Current status: %s",
 			attempt+1, maxAttempts, describeOutput.Job.Status)
 
-		time.Sleep(backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
 		backoff = time.Duration(float64(backoff) * 1.5) // Exponential backoff
 		if backoff > 30*time.Second {
 			backoff = 30 * time.Second // Cap at 30 seconds
@@ -167,3 +171,153 @@ func getCurrentETag(ctx context.Context, s3Client *s3.Client, bucket, key string
 	}
 	return *headOutput.ETag, nil
 }
+
+// FindBatchJobForManifest looks for a restore job that was already created for
+// the given manifest and has not failed or been cancelled. It returns an empty
+// job ID if there is none.
+func FindBatchJobForManifest(ctx context.Context, client S3ControlClientInterface, accountID, manifestBucket, manifestKey string) (string, error) {
+	manifestArn := fmt.Sprintf("arn:aws:s3:::%s/%s", manifestBucket, manifestKey)
+
+	paginator := s3control.NewListJobsPaginator(client, &s3control.ListJobsInput{
+		AccountId: aws.String(accountID),
+		JobStatuses: []types.JobStatus{
+			types.JobStatusNew,
+			types.JobStatusPreparing,
+			types.JobStatusSuspended,
+			types.JobStatusReady,
+			types.JobStatusActive,
+			types.JobStatusComplete,
+		},
+	})
+
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to list batch jobs: %w", err)
+		}
+
+		for _, job := range output.Jobs {
+			if job.Operation != types.OperationNameS3InitiateRestoreObject {
+				continue
+			}
+			describeOutput, err := client.DescribeJob(ctx, &s3control.DescribeJobInput{
+				AccountId: aws.String(accountID),
+				JobId:     job.JobId,
+			})
+			if err != nil {
+				return "", fmt.Errorf("failed to describe job %s: %w", aws.ToString(job.JobId), err)
+			}
+			if jobUsesManifest(describeOutput.Job, manifestArn) {
+				log.Printf("Found existing S3 Batch Operations job %s for manifest %s", aws.ToString(job.JobId), manifestArn)
+				return aws.ToString(job.JobId), nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func jobUsesManifest(job *types.JobDescriptor, manifestArn string) bool {
+	if job == nil || job.Manifest == nil || job.Manifest.Location == nil {
+		return false
+	}
+	return aws.ToString(job.Manifest.Location.ObjectArn) == manifestArn
+}
+
+// ResumeS3BatchJob prepares an existing batch job to be monitored again. It
+// returns false if the job failed or was cancelled and a new one is needed.
+// A job left suspended by a worker that died before starting it is started.
+func ResumeS3BatchJob(ctx context.Context, client S3ControlClientInterface, accountID, jobID string) (bool, error) {
+	describeOutput, err := client.DescribeJob(ctx, &s3control.DescribeJobInput{
+		AccountId: aws.String(accountID),
+		JobId:     aws.String(jobID),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to describe job %s: %w", jobID, err)
+	}
+
+	status := describeOutput.Job.Status
+	log.Printf("Existing S3 Batch Operations job %s has status %s", jobID, status)
+
+	switch status {
+	case types.JobStatusFailed, types.JobStatusCancelled, types.JobStatusCancelling:
+		return false, nil
+	case types.JobStatusSuspended:
+		_, err = client.UpdateJobStatus(ctx, &s3control.UpdateJobStatusInput{
+			AccountId:          aws.String(accountID),
+			JobId:              aws.String(jobID),
+			RequestedJobStatus: types.RequestedJobStatusReady,
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to start S3 Batch Operations job %s: %w", jobID, err)
+		}
+		log.Printf("S3 Batch Operations job %s has been started", jobID)
+	}
+
+	return true, nil
+}
+
+// BatchJobManager controls existing S3 Batch Operations jobs on behalf of the API.
+type BatchJobManager struct {
+	client         S3ControlClientInterface
+	accountID      string
+	manifestBucket string
+}
+
+func NewBatchJobManager(client S3ControlClientInterface, accountID, manifestBucket string) *BatchJobManager {
+	return &BatchJobManager{
+		client:         client,
+		accountID:      accountID,
+		manifestBucket: manifestBucket,
+	}
+}
+
+// FindBatchJob returns the restore job created for a manifest in the manifest
+// bucket, or an empty job ID if there is none.
+func (m *BatchJobManager) FindBatchJob(ctx context.Context, manifestKey string) (string, error) {
+	return FindBatchJobForManifest(ctx, m.client, m.accountID, m.manifestBucket, manifestKey)
+}
+
+// IsBatchJobForManifest reports whether a batch job restores the objects listed
+// in a manifest in the manifest bucket.
+func (m *BatchJobManager) IsBatchJobForManifest(ctx context.Context, jobID, manifestKey string) (bool, error) {
+	describeOutput, err := m.client.DescribeJob(ctx, &s3control.DescribeJobInput{
+		AccountId: aws.String(m.accountID),
+		JobId:     aws.String(jobID),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to describe job %s: %w", jobID, err)
+	}
+	return jobUsesManifest(describeOutput.Job, fmt.Sprintf("arn:aws:s3:::%s/%s", m.manifestBucket, manifestKey)), nil
+}
+
+// CancelBatchJob requests cancellation of a batch job. Jobs that have already
+// finished are left alone.
+func (m *BatchJobManager) CancelBatchJob(ctx context.Context, jobID string) error {
+	describeOutput, err := m.client.DescribeJob(ctx, &s3control.DescribeJobInput{
+		AccountId: aws.String(m.accountID),
+		JobId:     aws.String(jobID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe job %s: %w", jobID, err)
+	}
+
+	switch describeOutput.Job.Status {
+	case types.JobStatusComplete, types.JobStatusFailed, types.JobStatusCancelled, types.JobStatusCancelling:
+		log.Printf("S3 Batch Operations job %s is already %s, not cancelling", jobID, describeOutput.Job.Status)
+		return nil
+	}
+
+	_, err = m.client.UpdateJobStatus(ctx, &s3control.UpdateJobStatusInput{
+		AccountId:          aws.String(m.accountID),
+		JobId:              aws.String(jobID),
+		RequestedJobStatus: types.RequestedJobStatusCancelled,
+		StatusUpdateReason: aws.String("Restore cancelled by user"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to cancel S3 Batch Operations job %s: %w", jobID, err)
+	}
+
+	log.Printf("S3 Batch Operations job %s has been cancelled", jobID)
+	return nil
+}
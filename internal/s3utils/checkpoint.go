@@ -0,0 +1,175 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Checkpoint records how far a worker got with a restore so that a replacement
+// pod can pick up where it left off instead of starting a second batch job.
+type Checkpoint struct {
+	BatchJobID string    `json:"batchJobId"`
+	Downloaded []S3Entry `json:"downloaded"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// CheckpointKey returns the key of the checkpoint stored alongside a manifest.
+func CheckpointKey(manifestKey string) string {
+	return strings.TrimSuffix(manifestKey, ".csv") + ".checkpoint.json"
+}
+
+// LoadCheckpoint fetches the checkpoint for a manifest. A missing checkpoint is
+// not an error and returns an empty Checkpoint.
+func LoadCheckpoint(ctx context.Context, client S3ObjectClient, bucket, manifestKey string) (*Checkpoint, error) {
+	key := CheckpointKey(manifestKey)
+	output, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return &Checkpoint{}, nil
+		}
+		return nil, fmt.Errorf("failed to get checkpoint s3://%s/%s: %w", bucket, key, err)
+	}
+	defer output.Body.Close()
+
+	var checkpoint Checkpoint
+	if err := json.NewDecoder(output.Body).Decode(&checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint s3://%s/%s: %w", bucket, key, err)
+	}
+	log.Printf("Loaded checkpoint: batch job %q, %d files already downloaded", checkpoint.BatchJobID, len(checkpoint.Downloaded))
+	return &checkpoint, nil
+}
+
+func SaveCheckpoint(ctx context.Context, client S3ObjectClient, bucket, manifestKey string, checkpoint *Checkpoint) error {
+	checkpoint.UpdatedAt = time.Now()
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	key := CheckpointKey(manifestKey)
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint s3://%s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// MarkDownloaded adds entries to the checkpoint's downloaded set.
+func (c *Checkpoint) MarkDownloaded(entries []S3Entry) {
+	c.Downloaded = append(c.Downloaded, entries...)
+}
+
+// Pending returns the entries that have not been downloaded yet.
+func (c *Checkpoint) Pending(entries []S3Entry) []S3Entry {
+	done := make(map[S3Entry]bool, len(c.Downloaded))
+	for _, entry := range c.Downloaded {
+		done[entry] = true
+	}
+
+	var pending []S3Entry
+	for _, entry := range entries {
+		if !done[entry] {
+			pending = append(pending, entry)
+		}
+	}
+	return pending
+}
+
+// The checkpoint is saved every checkpointSaveFiles downloaded files or every
+// checkpointSaveInterval, whichever comes first.
+var (
+	checkpointSaveFiles    = 1000
+	checkpointSaveInterval = 2 * time.Minute
+)
+
+// CheckpointRecorder adds files to a checkpoint as they are downloaded and saves
+// it periodically, so a worker that is killed mid-download loses little
+// progress. It is safe for concurrent use by several download pools.
+type CheckpointRecorder struct {
+	mu         sync.Mutex
+	checkpoint *Checkpoint
+	save       func(*Checkpoint)
+	unsaved    int
+	savedAt    time.Time
+}
+
+// NewCheckpointRecorder records into checkpoint, calling save to persist it.
+func NewCheckpointRecorder(checkpoint *Checkpoint, save func(*Checkpoint)) *CheckpointRecorder {
+	return &CheckpointRecorder{checkpoint: checkpoint, save: save, savedAt: time.Now()}
+}
+
+// Record marks a successfully downloaded file and saves the checkpoint when
+// enough files or time have passed since the last save.
+func (r *CheckpointRecorder) Record(result FileResult) {
+	if result.Err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checkpoint.MarkDownloaded([]S3Entry{result.S3Entry})
+	r.unsaved++
+	if r.unsaved >= checkpointSaveFiles || time.Since(r.savedAt) >= checkpointSaveInterval {
+		r.saveLocked()
+	}
+}
+
+// SetBatchJobID records the batch job restoring the archived files and saves
+// the checkpoint.
+func (r *CheckpointRecorder) SetBatchJobID(jobID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.checkpoint.BatchJobID = jobID
+	r.saveLocked()
+}
+
+// BatchJobID returns the batch job recorded in the checkpoint.
+func (r *CheckpointRecorder) BatchJobID() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.checkpoint.BatchJobID
+}
+
+// Pending returns the entries that have not been downloaded yet.
+func (r *CheckpointRecorder) Pending(entries []S3Entry) []S3Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.checkpoint.Pending(entries)
+}
+
+// Save saves the checkpoint if anything was recorded since the last save.
+func (r *CheckpointRecorder) Save() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.unsaved > 0 {
+		r.saveLocked()
+	}
+}
+
+func (r *CheckpointRecorder) saveLocked() {
+	r.save(r.checkpoint)
+	r.unsaved = 0
+	r.savedAt = time.Now()
+}
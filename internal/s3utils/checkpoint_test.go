@@ -0,0 +1,176 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3control"
+	"github.com/aws/aws-sdk-go-v2/service/s3control/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeObjectStore struct {
+	objects map[string][]byte
+}
+
+func (f *fakeObjectStore) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	data, ok := f.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)]
+	if !ok {
+		return nil, &s3types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data))}, nil
+}
+
+func (f *fakeObjectStore) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	data, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[aws.ToString(params.Bucket)+"/"+aws.ToString(params.Key)] = data
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestCheckpointRoundTrip(t *testing.T) {
+	store := &fakeObjectStore{objects: map[string][]byte{}}
+	ctx := context.Background()
+	manifestKey := "batch-manifests/1234_test_user_2024-01-01_00-00-00.csv"
+
+	checkpoint, err := LoadCheckpoint(ctx, store, "manifest-bucket", manifestKey)
+	assert.NoError(t, err)
+	assert.Empty(t, checkpoint.BatchJobID)
+
+	checkpoint.BatchJobID = "job-1"
+	checkpoint.MarkDownloaded([]S3Entry{{Bucket: "bucket1", Key: "a.mov"}})
+	assert.NoError(t, SaveCheckpoint(ctx, store, "manifest-bucket", manifestKey, checkpoint))
+	assert.Contains(t, store.objects, "manifest-bucket/batch-manifests/1234_test_user_2024-01-01_00-00-00.checkpoint.json")
+
+	loaded, err := LoadCheckpoint(ctx, store, "manifest-bucket", manifestKey)
+	assert.NoError(t, err)
+	assert.Equal(t, "job-1", loaded.BatchJobID)
+
+	pending := loaded.Pending([]S3Entry{
+		{Bucket: "bucket1", Key: "a.mov"},
+		{Bucket: "bucket1", Key: "b.mov"},
+	})
+	assert.Equal(t, []S3Entry{{Bucket: "bucket1", Key: "b.mov"}}, pending)
+}
+
+type fakeS3ControlClient struct {
+	jobs          map[string]*types.JobDescriptor
+	statusUpdates map[string]types.RequestedJobStatus
+}
+
+func (f *fakeS3ControlClient) ListJobs(ctx context.Context, params *s3control.ListJobsInput, optFns ...func(*s3control.Options)) (*s3control.ListJobsOutput, error) {
+	output := &s3control.ListJobsOutput{}
+	for id := range f.jobs {
+		output.Jobs = append(output.Jobs, types.JobListDescriptor{
+			JobId:     aws.String(id),
+			Operation: types.OperationNameS3InitiateRestoreObject,
+		})
+	}
+	return output, nil
+}
+
+func (f *fakeS3ControlClient) DescribeJob(ctx context.Context, params *s3control.DescribeJobInput, optFns ...func(*s3control.Options)) (*s3control.DescribeJobOutput, error) {
+	return &s3control.DescribeJobOutput{Job: f.jobs[aws.ToString(params.JobId)]}, nil
+}
+
+func (f *fakeS3ControlClient) UpdateJobStatus(ctx context.Context, params *s3control.UpdateJobStatusInput, optFns ...func(*s3control.Options)) (*s3control.UpdateJobStatusOutput, error) {
+	f.statusUpdates[aws.ToString(params.JobId)] = params.RequestedJobStatus
+	return &s3control.UpdateJobStatusOutput{}, nil
+}
+
+func newJobDescriptor(manifestKey string, status types.JobStatus) *types.JobDescriptor {
+	return &types.JobDescriptor{
+		Status: status,
+		Manifest: &types.JobManifest{
+			Location: &types.JobManifestLocation{
+				ObjectArn: aws.String("arn:aws:s3:::manifest-bucket/" + manifestKey),
+			},
+		},
+	}
+}
+
+func TestFindAndResumeBatchJob(t *testing.T) {
+	client := &fakeS3ControlClient{
+		jobs: map[string]*types.JobDescriptor{
+			"other-job":     newJobDescriptor("batch-manifests/other.csv", types.JobStatusActive),
+			"suspended-job": newJobDescriptor("batch-manifests/ours.csv", types.JobStatusSuspended),
+		},
+		statusUpdates: map[string]types.RequestedJobStatus{},
+	}
+	ctx := context.Background()
+
+	jobID, err := FindBatchJobForManifest(ctx, client, "123456789012", "manifest-bucket", "batch-manifests/ours.csv")
+	assert.NoError(t, err)
+	assert.Equal(t, "suspended-job", jobID)
+
+	jobID, err = FindBatchJobForManifest(ctx, client, "123456789012", "manifest-bucket", "batch-manifests/missing.csv")
+	assert.NoError(t, err)
+	assert.Empty(t, jobID)
+
+	// A suspended job is started when resumed
+	usable, err := ResumeS3BatchJob(ctx, client, "123456789012", "suspended-job")
+	assert.NoError(t, err)
+	assert.True(t, usable)
+	assert.Equal(t, types.RequestedJobStatusReady, client.statusUpdates["suspended-job"])
+
+	client.jobs["cancelled-job"] = newJobDescriptor("batch-manifests/ours.csv", types.JobStatusCancelled)
+	usable, err = ResumeS3BatchJob(ctx, client, "123456789012", "cancelled-job")
+	assert.NoError(t, err)
+	assert.False(t, usable)
+
+	// Only jobs reading the restore's own manifest belong to it
+	manager := NewBatchJobManager(client, "123456789012", "manifest-bucket")
+	ours, err := manager.IsBatchJobForManifest(ctx, "suspended-job", "batch-manifests/ours.csv")
+	assert.NoError(t, err)
+	assert.True(t, ours)
+	ours, err = manager.IsBatchJobForManifest(ctx, "other-job", "batch-manifests/ours.csv")
+	assert.NoError(t, err)
+	assert.False(t, ours)
+}
+
+func TestCheckpointRecorder(t *testing.T) {
+	previousFiles, previousInterval := checkpointSaveFiles, checkpointSaveInterval
+	checkpointSaveFiles, checkpointSaveInterval = 2, time.Hour
+	t.Cleanup(func() { checkpointSaveFiles, checkpointSaveInterval = previousFiles, previousInterval })
+
+	var saved [][]S3Entry
+	recorder := NewCheckpointRecorder(&Checkpoint{}, func(checkpoint *Checkpoint) {
+		saved = append(saved, append([]S3Entry(nil), checkpoint.Downloaded...))
+	})
+
+	// Failed downloads aren't recorded, and a save happens every two files
+	recorder.Record(FileResult{S3Entry: S3Entry{Bucket: "bucket1", Key: "a.mov"}})
+	recorder.Record(FileResult{S3Entry: S3Entry{Bucket: "bucket1", Key: "b.mov"}, Err: errors.New("failed")})
+	assert.Empty(t, saved)
+	recorder.Record(FileResult{S3Entry: S3Entry{Bucket: "bucket1", Key: "c.mov"}})
+	assert.Equal(t, [][]S3Entry{{{Bucket: "bucket1", Key: "a.mov"}, {Bucket: "bucket1", Key: "c.mov"}}}, saved)
+
+	// Save only writes when something is unsaved
+	recorder.Save()
+	assert.Len(t, saved, 1)
+	recorder.Record(FileResult{S3Entry: S3Entry{Bucket: "bucket1", Key: "d.mov"}})
+	recorder.Save()
+	assert.Len(t, saved, 2)
+
+	// Files finishing after the interval are saved straight away
+	checkpointSaveInterval = 0
+	recorder.Record(FileResult{S3Entry: S3Entry{Bucket: "bucket1", Key: "e.mov"}})
+	assert.Len(t, saved, 3)
+
+	recorder.SetBatchJobID("job-1")
+	assert.Len(t, saved, 4)
+	assert.Equal(t, "job-1", recorder.BatchJobID())
+	assert.Equal(t, []S3Entry{{Bucket: "bucket1", Key: "b.mov"}}, recorder.Pending([]S3Entry{
+		{Bucket: "bucket1", Key: "a.mov"},
+		{Bucket: "bucket1", Key: "b.mov"},
+	}))
+}
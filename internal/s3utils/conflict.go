@@ -0,0 +1,81 @@
+package s3utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	restoreTypes "pluto-restore-assets/internal/types"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Actions taken for a file, as reported in FileResult.
+const (
+	ActionDownloaded  = "downloaded"
+	ActionOverwritten = "overwritten"
+	ActionKeptBoth    = "kept-both"
+	ActionSkipped     = "skipped"
+	ActionRejected    = "rejected" // the key isn't safe to write, see safeRelativePath
+)
+
+// resolveConflict decides what to do with an object whose target path may
+// already exist, returning one of the actions above.
+func resolveConflict(path string, head *s3.HeadObjectOutput, policy restoreTypes.ConflictPolicy) (string, error) {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return ActionDownloaded, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check existing file %s: %w", path, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("failed to create file %s: a directory with that name exists", path)
+	}
+
+	switch policy {
+	case restoreTypes.ConflictPolicySkip:
+		return ActionSkipped, nil
+	case restoreTypes.ConflictPolicyOverwrite:
+		return ActionOverwritten, nil
+	case restoreTypes.ConflictPolicyKeepBoth:
+		return ActionKeptBoth, nil
+	default:
+		if isIdentical(path, info, head) {
+			return ActionSkipped, nil
+		}
+		return ActionKeptBoth, nil
+	}
+}
+
+// isIdentical reports whether a local file matches the archived object, either
+// by size and modification time or by size and checksum. Restored files are
+// given the object's original modification time, so they match by time.
+func isIdentical(path string, info os.FileInfo, head *s3.HeadObjectOutput) bool {
+	if head.ContentLength == nil || info.Size() != *head.ContentLength {
+		return false
+	}
+	if mtime, _ := originalTimes(head); !mtime.IsZero() && info.ModTime().Truncate(time.Second).Equal(mtime.Truncate(time.Second)) {
+		return true
+	}
+	method, err := verifyFile(path, head)
+	return err == nil && method != VerifiedSize
+}
+
+// uniquePath returns path if nothing exists there, or otherwise the first free
+// "name (n).ext" next to it.
+func uniquePath(path string) string {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for n := 1; ; n++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, n, ext)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
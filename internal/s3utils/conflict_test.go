@@ -0,0 +1,77 @@
+package s3utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	restoreTypes "pluto-restore-assets/internal/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveConflict(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "clip.mxf")
+	assert.NoError(t, os.WriteFile(existing, []byte("original"), 0664))
+	lastModified := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes(existing, lastModified, lastModified))
+
+	identical := &s3.HeadObjectOutput{ContentLength: aws.Int64(8), LastModified: aws.Time(lastModified)}
+	different := &s3.HeadObjectOutput{ContentLength: aws.Int64(9), LastModified: aws.Time(lastModified)}
+
+	testCases := []struct {
+		name           string
+		path           string
+		head           *s3.HeadObjectOutput
+		policy         restoreTypes.ConflictPolicy
+		expectedAction string
+	}{
+		{"No existing file", filepath.Join(dir, "new.mxf"), different, restoreTypes.ConflictPolicySkip, ActionDownloaded},
+		{"Skip", existing, different, restoreTypes.ConflictPolicySkip, ActionSkipped},
+		{"Overwrite", existing, identical, restoreTypes.ConflictPolicyOverwrite, ActionOverwritten},
+		{"Keep both", existing, identical, restoreTypes.ConflictPolicyKeepBoth, ActionKeptBoth},
+		{"Skip if identical with matching file", existing, identical, restoreTypes.ConflictPolicySkipIfIdentical, ActionSkipped},
+		{"Skip if identical with different file", existing, different, restoreTypes.ConflictPolicySkipIfIdentical, ActionKeptBoth},
+		{"Default policy", existing, identical, "", ActionSkipped},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			action, err := resolveConflict(tc.path, tc.head, tc.policy)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedAction, action)
+		})
+	}
+}
+
+func TestIsIdenticalByChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.mxf")
+	assert.NoError(t, os.WriteFile(path, []byte("original"), 0664))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+
+	// The modification time differs, but the ETag matches
+	head := &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(8),
+		LastModified:  aws.Time(time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)),
+		ETag:          aws.String(`"919c8b643b7133116b02fc0d9bb7df3f"`),
+	}
+	assert.True(t, isIdentical(path, info, head))
+
+	head.ETag = aws.String(`"00000000000000000000000000000000"`)
+	assert.False(t, isIdentical(path, info, head))
+}
+
+func TestUniquePath(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "clip.mxf")
+	assert.Equal(t, path, uniquePath(path))
+
+	assert.NoError(t, os.WriteFile(path, nil, 0664))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "clip (1).mxf"), nil, 0664))
+	assert.Equal(t, filepath.Join(dir, "clip (2).mxf"), uniquePath(path))
+}
@@ -0,0 +1,88 @@
+package s3utils
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	restoreTypes "pluto-restore-assets/internal/types"
+)
+
+// localFiles holds the sizes of the files found by walking a project folder.
+type localFiles struct {
+	root  string
+	sizes map[string]int64
+}
+
+// indexLocalFiles walks root, ignoring unfinished downloads. A root that doesn't
+// exist yet has no files.
+func indexLocalFiles(root string) (*localFiles, error) {
+	local := &localFiles{root: filepath.Clean(root), sizes: make(map[string]int64)}
+	err := filepath.WalkDir(local.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || isTempFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		local.sizes[path] = info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list local files in %s: %w", root, err)
+	}
+	return local, nil
+}
+
+// size returns the size of the regular file at path, checking paths outside the
+// walked folder directly.
+func (l *localFiles) size(path string) (int64, bool) {
+	if path == l.root || strings.HasPrefix(path, l.root+string(os.PathSeparator)) {
+		size, ok := l.sizes[path]
+		return size, ok
+	}
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// presentFiles recognises objects that already exist under the base path at
+// the path they would be restored to and with the same size. A nil presentFiles
+// contains nothing.
+type presentFiles struct {
+	local    *localFiles
+	basePath string
+	escaping KeyEscaping
+}
+
+func newPresentFiles(params restoreTypes.RestoreParams) (*presentFiles, error) {
+	local, err := indexLocalFiles(filepath.Join(params.BasePath, params.RestorePath))
+	if err != nil {
+		return nil, err
+	}
+	return &presentFiles{local: local, basePath: params.BasePath, escaping: KeyEscaping(params.KeyEscaping)}, nil
+}
+
+func (p *presentFiles) contains(object ManifestObject) bool {
+	if p == nil {
+		return false
+	}
+	path, err := LocalPath(p.basePath, object.Key, p.escaping)
+	if err != nil {
+		return false
+	}
+	size, ok := p.local.size(path)
+	return ok && size == object.Size
+}
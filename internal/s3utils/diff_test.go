@@ -0,0 +1,61 @@
+package s3utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	restoreTypes "pluto-restore-assets/internal/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPresentFiles(t *testing.T) {
+	basePath := t.TempDir()
+	write := func(rel, content string) {
+		path := filepath.Join(basePath, rel)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	write("Project/present.mov", "abc")
+	write("Project/Rushes/changed.mov", "abcde")
+	write("Project/Scene 1_ Intro.mov", "abcd")
+	write("Project/.partial.mov.partial.restoring", "ab")
+	write("Other/outside.mov", "abcdef")
+
+	present, err := newPresentFiles(restoreTypes.RestoreParams{
+		BasePath:    basePath,
+		RestorePath: "Project/",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		key      string
+		size     int64
+		expected bool
+	}{
+		{"Project/present.mov", 3, true},
+		{"Project/Rushes/changed.mov", 6, false},
+		{"Project/missing.mov", 1, false},
+		{"Project/Scene 1: Intro.mov", 4, true},
+		{"Project/partial.mov", 2, false},
+		{"Other/outside.mov", 6, true},
+		{"Project/../../etc/passwd", 3, false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, present.contains(ManifestObject{Bucket: "bucket", Key: tt.key, Size: tt.size}), tt.key)
+	}
+}
+
+func TestPresentFilesWithoutLocalFolder(t *testing.T) {
+	present, err := newPresentFiles(restoreTypes.RestoreParams{
+		BasePath:    t.TempDir(),
+		RestorePath: "Project/",
+	})
+	require.NoError(t, err)
+	assert.False(t, present.contains(ManifestObject{Bucket: "bucket", Key: "Project/clip.mov", Size: 1}))
+
+	var none *presentFiles
+	assert.False(t, none.contains(ManifestObject{Bucket: "bucket", Key: "Project/clip.mov", Size: 1}))
+}
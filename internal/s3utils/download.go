@@ -2,21 +2,108 @@ package s3utils
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"pluto-restore-assets/internal/diskspace"
+	restoreTypes "pluto-restore-assets/internal/types"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-func DownloadFiles(ctx context.Context, client *s3.Client, keys []S3Entry, basePath string, uid, gid int) error {
+// tempFileSuffix marks files that are still being downloaded.
+const tempFileSuffix = ".restoring"
+
+const defaultDownloadWorkers = 10
+
+// spaceCheckInterval is how often paused downloads check for free space again.
+var spaceCheckInterval = time.Minute
+
+// DownloadOptions describes where and how downloaded files are written. Zero
+// values for the concurrency settings fall back to the defaults.
+type DownloadOptions struct {
+	BasePath        string
+	FileOwnerUID    int
+	FileOwnerGID    int
+	QuarantinePath  string // where files failing verification are moved
+	ConflictPolicy  restoreTypes.ConflictPolicy
+	Workers         int               // files downloaded at once
+	PartConcurrency int               // parts of each file downloaded at once
+	PartSize        int64             // bytes per ranged GET
+	Limiter         *BandwidthLimiter // shared by every download, may be nil
+	MinFreeBytes    int64             // downloads pause rather than leave less free
+	// Restore permissions and extended attributes stored in object metadata
+	PreserveAttributes bool
+	KeyEscaping        KeyEscaping
+	// Called with each file's result as it finishes, may be nil
+	OnResult func(FileResult)
+}
+
+func (o DownloadOptions) withDefaults() DownloadOptions {
+	if o.Workers <= 0 {
+		o.Workers = defaultDownloadWorkers
+	}
+	if o.PartConcurrency <= 0 {
+		o.PartConcurrency = manager.DefaultDownloadConcurrency
+	}
+	if o.PartSize <= 0 {
+		o.PartSize = manager.DefaultDownloadPartSize
+	}
+	return o
+}
+
+// newDownloader creates a downloader with the part settings of opts.
+func (o DownloadOptions) newDownloader(client manager.DownloadAPIClient) *manager.Downloader {
+	return manager.NewDownloader(client, func(d *manager.Downloader) {
+		d.PartSize = o.PartSize
+		d.Concurrency = o.PartConcurrency
+	})
+}
+
+// FileResult is the outcome of downloading a single object.
+type FileResult struct {
+	S3Entry
+	Path           string `json:"path"`
+	Action         string `json:"action,omitempty"`
+	Size           int64  `json:"size"`
+	Verification   string `json:"verification,omitempty"`
+	DurationMs     int64  `json:"durationMs"`
+	Retries        int    `json:"retries"`
+	QuarantinePath string `json:"quarantinePath,omitempty"`
+	Error          string `json:"error,omitempty"`
+	Err            error  `json:"-"`
+}
+
+// DownloadFiles downloads keys under opts.BasePath and returns the result of
+// every file it attempted, including when it is stopped early by ctx.
+func DownloadFiles(ctx context.Context, client S3DownloadClient, keys []S3Entry, opts DownloadOptions, onProgress ProgressFunc) ([]FileResult, error) {
+	jobs := make(chan S3Entry, len(keys))
+	for _, key := range keys {
+		jobs <- key
+	}
+	close(jobs)
+
+	return DownloadStream(ctx, client, jobs, len(keys), opts, onProgress)
+}
+
+// DownloadStream downloads keys as they arrive until the channel is closed. total
+// is only used for progress reporting.
+func DownloadStream(ctx context.Context, client S3DownloadClient, keys <-chan S3Entry, total int, opts DownloadOptions, onProgress ProgressFunc) ([]FileResult, error) {
 	// Clean and normalize the path
-	basePath = filepath.Clean(basePath)
-	log.Printf("Downloading %d files", len(keys))
+	opts = opts.withDefaults()
+	basePath := filepath.Clean(opts.BasePath)
+	opts.BasePath = basePath
+	log.Printf("Downloading %d files with %d workers, %d parts of %d bytes at a time", total, opts.Workers, opts.PartConcurrency, opts.PartSize)
 	log.Printf("Base path: %s", basePath)
 
 	// Create each directory component separately to handle spaces
@@ -28,89 +115,304 @@ func DownloadFiles(ctx context.Context, client *s3.Client, keys []S3Entry, baseP
 		}
 		currentPath = filepath.Join(currentPath, component)
 		if err := os.MkdirAll(currentPath, 0755); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", currentPath, err)
+			return nil, fmt.Errorf("failed to create directory %s: %w", currentPath, err)
 		}
 	}
 
 	// Verify base path was created
 	if _, err := os.Stat(basePath); err != nil {
-		return fmt.Errorf("failed to verify base path creation %s: %w", basePath, err)
+		return nil, fmt.Errorf("failed to verify base path creation %s: %w", basePath, err)
 	}
 
-	// Create a worker pool
-	workerCount := 10 // Adjust based on system capabilities
-	jobs := make(chan S3Entry, len(keys))
-	results := make(chan error, len(keys))
-
 	// Start worker pool
-	for w := 1; w <= workerCount; w++ {
-		go worker(ctx, client, basePath, jobs, results, uid, gid)
-	}
-
-	// Send jobs to workers
-	for _, key := range keys {
-		jobs <- key
+	results := make(chan FileResult)
+	var wg sync.WaitGroup
+	for w := 1; w <= opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker(ctx, client, opts, keys, results)
+		}()
 	}
-	close(jobs)
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
 
 	// Collect results
-	for i := 0; i < len(keys); i++ {
-		if err := <-results; err != nil {
-			log.Printf("Error downloading file: %v", err)
+	var fileResults []FileResult
+	done := 0
+	for result := range results {
+		if result.Err != nil {
+			log.Printf("Error downloading file: %v", result.Err)
+		}
+		fileResults = append(fileResults, result)
+		if opts.OnResult != nil {
+			opts.OnResult(result)
+		}
+		done++
+		if onProgress != nil {
+			onProgress(done, total)
 		}
 	}
 
-	return nil
+	if ctx.Err() != nil {
+		log.Println("Downloads stopped before completion")
+		return fileResults, ctx.Err()
+	}
+
+	return fileResults, nil
 }
 
-func worker(ctx context.Context, client *s3.Client, basePath string, jobs <-chan S3Entry, results chan<- error, uid, gid int) {
+func worker(ctx context.Context, client S3DownloadClient, opts DownloadOptions, jobs <-chan S3Entry, results chan<- FileResult) {
 	for job := range jobs {
-		results <- downloadFile(ctx, client, job.Bucket, job.Key, basePath, uid, gid)
+		// Drain remaining jobs without starting new downloads once cancelled
+		if ctx.Err() != nil {
+			results <- FileResult{S3Entry: job, Err: ctx.Err()}
+			continue
+		}
+		start := time.Now()
+		result := withRetries(ctx, func() FileResult {
+			return downloadFile(ctx, client, job, opts)
+		})
+		result.DurationMs = time.Since(start).Milliseconds()
+		results <- result
 	}
 }
 
-func downloadFile(ctx context.Context, client *s3.Client, bucket, key, basePath string, uid, gid int) error {
-	fullPath := filepath.Join(basePath, key)
+func downloadFile(ctx context.Context, client S3DownloadClient, entry S3Entry, opts DownloadOptions) FileResult {
+	bucket, key := entry.Bucket, entry.Key
+	result := FileResult{S3Entry: entry}
+
+	// Keys come from the archive and are never trusted to stay inside the base path
+	rel, err := safeRelativePath(key, opts.KeyEscaping)
+	if err != nil {
+		result.Action = ActionRejected
+		result.Err = err
+		return result
+	}
+	if rel != key {
+		log.Printf("Saving %s/%s as %s", bucket, key, rel)
+	}
+	fullPath := filepath.Join(opts.BasePath, rel)
+	result.Path = fullPath
 	dir := filepath.Dir(fullPath)
 
 	// Create directory with correct permissions (0775 = drwxrwxr-x)
-	err := os.MkdirAll(dir, 0775)
+	err = os.MkdirAll(dir, 0775)
 	if err != nil {
 		if !os.IsExist(err) {
-			return fmt.Errorf("failed to create directory %s: %w", dir, err)
+			result.Err = fmt.Errorf("failed to create directory %s: %w", dir, err)
+			return result
 		}
 		log.Printf("Directory already exists: %s", dir)
 	}
 
 	// Set directory ownership
-	if err := os.Chown(dir, uid, gid); err != nil {
-		return fmt.Errorf("failed to set directory ownership %s: %w", dir, err)
+	if err := os.Chown(dir, opts.FileOwnerUID, opts.FileOwnerGID); err != nil {
+		result.Err = fmt.Errorf("failed to set directory ownership %s: %w", dir, err)
+		return result
+	}
+
+	// The stored checksums are only returned in full by HeadObject, as the
+	// downloader fetches the object in ranges
+	head, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		result.Err = fmt.Errorf("failed to get object metadata %s/%s: %w", bucket, key, err)
+		return result
 	}
 
 	finalPath := fullPath
-	// Create file with correct permissions (0664 = rw-rw-r--)
-	file, err := os.OpenFile(finalPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0664)
+	result.Action, err = resolveConflict(finalPath, head, opts.ConflictPolicy)
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", finalPath, err)
+		result.Err = err
+		return result
+	}
+	if result.Action == ActionSkipped {
+		log.Printf("Skipping %s/%s, %s already exists", bucket, key, finalPath)
+		return result
+	}
+
+	if opts.MinFreeBytes > 0 {
+		needed := aws.ToInt64(head.ContentLength) + opts.MinFreeBytes
+		if err := diskspace.WaitForSpace(ctx, dir, needed, spaceCheckInterval); err != nil {
+			result.Err = fmt.Errorf("failed waiting for free space for %s/%s: %w", bucket, key, err)
+			return result
+		}
+	}
+
+	// Download to a hidden file next to the final path so that nothing sees a
+	// partially written file, and rename it into place once it is complete.
+	// Large objects keep their partial file between attempts so that they can
+	// resume where they stopped.
+	var tempPath string
+	var numBytes int64
+	if aws.ToInt64(head.ContentLength) >= resumableDownloadSize {
+		tempPath = resumableTempPath(finalPath)
+		defer func() {
+			if result.Err == nil || !keepPartialDownload(result.Err) {
+				removePartialDownload(tempPath)
+			}
+		}()
+		log.Printf("Starting resumable download to %s", tempPath)
+		numBytes, err = downloadResumable(ctx, client, entry, head, tempPath, opts)
+	} else {
+		tempPath, numBytes, err = downloadToTempFile(ctx, client, entry, finalPath, opts)
+		defer func() {
+			if result.Err != nil {
+				os.Remove(tempPath)
+			}
+		}()
+	}
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Size = numBytes
+
+	result.Verification, err = verifyFile(tempPath, head)
+	if err != nil {
+		result.Err = fmt.Errorf("verification failed for %s/%s: %w", bucket, key, err)
+		if opts.QuarantinePath == "" {
+			return result
+		}
+		quarantined, qErr := quarantineFile(tempPath, opts.QuarantinePath, rel)
+		if qErr != nil {
+			log.Printf("Error quarantining %s: %v", tempPath, qErr)
+			return result
+		}
+		log.Printf("Moved %s to quarantine at %s", finalPath, quarantined)
+		result.QuarantinePath = quarantined
+		return result
+	}
+
+	// Set file ownership
+	if err := os.Chown(tempPath, opts.FileOwnerUID, opts.FileOwnerGID); err != nil {
+		result.Err = fmt.Errorf("failed to set file ownership %s: %w", tempPath, err)
+		return result
+	}
+
+	if err := applyMetadata(tempPath, head, opts.PreserveAttributes); err != nil {
+		result.Err = err
+		return result
+	}
+
+	switch result.Action {
+	case ActionKeptBoth:
+		finalPath = uniquePath(fullPath)
+	case ActionDownloaded:
+		// Something else may have created the file while it was downloading
+		if _, err := os.Lstat(finalPath); err == nil {
+			result.Err = fmt.Errorf("failed to create file %s: %w", finalPath, os.ErrExist)
+			return result
+		}
+	}
+	if err := os.Rename(tempPath, finalPath); err != nil {
+		result.Err = fmt.Errorf("failed to move %s into place: %w", finalPath, err)
+		return result
+	}
+	result.Path = finalPath
+
+	log.Printf("Successfully downloaded %s/%s to %s (%d bytes, verified by %s, %s)", bucket, key, finalPath, numBytes, result.Verification, result.Action)
+	return result
+}
+
+// downloadToTempFile downloads an object in full to a new temporary file for
+// finalPath, returning its path even on failure so that it can be removed.
+func downloadToTempFile(ctx context.Context, client S3DownloadClient, entry S3Entry, finalPath string, opts DownloadOptions) (string, int64, error) {
+	file, err := createTempFile(finalPath)
+	if err != nil {
+		return "", 0, err
 	}
 	defer file.Close()
+	tempPath := file.Name()
 
-	log.Printf("Starting download to %s", finalPath)
-	downloader := manager.NewDownloader(client)
-	numBytes, err := downloader.Download(ctx, file, &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
+	log.Printf("Starting download to %s", tempPath)
+	numBytes, err := opts.newDownloader(client).Download(ctx, throttle(ctx, file, opts.Limiter), &s3.GetObjectInput{
+		Bucket:       aws.String(entry.Bucket),
+		Key:          aws.String(entry.Key),
+		ChecksumMode: types.ChecksumModeEnabled,
 	})
 	if err != nil {
-		os.Remove(finalPath)
-		return fmt.Errorf("failed to download file %s/%s: %w", bucket, key, err)
+		return tempPath, 0, fmt.Errorf("failed to download file %s/%s: %w", entry.Bucket, entry.Key, err)
 	}
 
-	// Set file ownership
-	if err := os.Chown(finalPath, uid, gid); err != nil {
-		return fmt.Errorf("failed to set file ownership %s: %w", finalPath, err)
+	if err := file.Sync(); err != nil {
+		return tempPath, 0, fmt.Errorf("failed to sync file %s: %w", tempPath, err)
+	}
+	if err := file.Close(); err != nil {
+		return tempPath, 0, fmt.Errorf("failed to close file %s: %w", tempPath, err)
+	}
+	return tempPath, numBytes, nil
+}
+
+// createTempFile creates the hidden file a download is written to before it is
+// renamed to finalPath.
+func createTempFile(finalPath string) (*os.File, error) {
+	file, err := os.CreateTemp(filepath.Dir(finalPath), "."+filepath.Base(finalPath)+".*"+tempFileSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file for %s: %w", finalPath, err)
 	}
+	// Create file with correct permissions (0664 = rw-rw-r--)
+	if err := file.Chmod(0664); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("failed to set permissions on %s: %w", file.Name(), err)
+	}
+	return file, nil
+}
 
-	log.Printf("Successfully downloaded %s/%s to %s (%d bytes)", bucket, key, finalPath, numBytes)
-	return nil
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempFileSuffix)
+}
+
+// CleanupTempFiles removes temporary download files under basePath that have not
+// been written to for olderThan, which are left behind when a worker crashes.
+func CleanupTempFiles(basePath string, olderThan time.Duration) (int, error) {
+	removed := 0
+	err := filepath.WalkDir(basePath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		// State left behind by a resumable download whose data is gone
+		if dataPath, ok := strings.CutSuffix(path, resumeStateSuffix); ok && isTempFile(filepath.Base(dataPath)) {
+			if _, err := os.Lstat(dataPath); errors.Is(err, fs.ErrNotExist) {
+				os.Remove(path)
+			}
+			return nil
+		}
+		if !isTempFile(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		maxAge := olderThan
+		// Resumable partial downloads are kept longer so a later restore can finish them
+		if _, err := os.Lstat(path + resumeStateSuffix); err == nil {
+			maxAge = max(olderThan, resumablePartialMaxAge)
+		}
+		if time.Since(info.ModTime()) < maxAge {
+			return nil
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale temporary file %s: %w", path, err)
+		}
+		os.Remove(path + resumeStateSuffix)
+		log.Printf("Removed stale temporary file %s", path)
+		removed++
+		return nil
+	})
+	return removed, err
 }
@@ -0,0 +1,195 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	restoreTypes "pluto-restore-assets/internal/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateTempFile(t *testing.T) {
+	finalPath := filepath.Join(t.TempDir(), "clip.mxf")
+
+	file, err := createTempFile(finalPath)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	name := filepath.Base(file.Name())
+	assert.True(t, strings.HasPrefix(name, ".clip.mxf."))
+	assert.True(t, isTempFile(name))
+	assert.Equal(t, filepath.Dir(finalPath), filepath.Dir(file.Name()))
+
+	info, err := file.Stat()
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0664), info.Mode().Perm())
+	assert.NoFileExists(t, finalPath)
+}
+
+func TestCleanupTempFiles(t *testing.T) {
+	basePath := t.TempDir()
+	stale := filepath.Join(basePath, "Project", ".clip.mxf.123"+tempFileSuffix)
+	active := filepath.Join(basePath, "Project", ".other.mxf.456"+tempFileSuffix)
+	complete := filepath.Join(basePath, "Project", "clip.mxf")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(stale), 0775))
+	for _, path := range []string{stale, active, complete} {
+		assert.NoError(t, os.WriteFile(path, []byte("data"), 0664))
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(stale, old, old))
+	assert.NoError(t, os.Chtimes(complete, old, old))
+
+	removed, err := CleanupTempFiles(basePath, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.NoFileExists(t, stale)
+	assert.FileExists(t, active)
+	assert.FileExists(t, complete)
+
+	// A project folder that doesn't exist yet has nothing to clean up
+	removed, err = CleanupTempFiles(filepath.Join(basePath, "missing"), time.Hour)
+	assert.NoError(t, err)
+	assert.Zero(t, removed)
+}
+
+// downloadObjectStore serves objects for the downloader. Objects in corrupt are
+// served with different content to their ETag, and reading one in broken fails
+// part way through.
+type downloadObjectStore struct {
+	objects map[string][]byte
+	corrupt map[string]bool
+	broken  map[string]bool
+}
+
+func (f *downloadObjectStore) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	data, ok := f.objects[aws.ToString(params.Key)]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	sum := md5.Sum(data)
+	return &s3.HeadObjectOutput{
+		ContentLength: aws.Int64(int64(len(data))),
+		ETag:          aws.String(`"` + hex.EncodeToString(sum[:]) + `"`),
+	}, nil
+}
+
+func (f *downloadObjectStore) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	key := aws.ToString(params.Key)
+	data := f.objects[key]
+	var start, end int64
+	if _, err := fmt.Sscanf(aws.ToString(params.Range), "bytes=%d-%d", &start, &end); err != nil {
+		return nil, err
+	}
+	end = min(end, int64(len(data))-1)
+	part := bytes.Clone(data[start : end+1])
+	if f.corrupt[key] {
+		part = bytes.ToUpper(part)
+	}
+	var body io.Reader = bytes.NewReader(part)
+	if f.broken[key] {
+		body = io.MultiReader(bytes.NewReader(part[:len(part)/2]), failingReader{})
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(body),
+		ContentLength: aws.Int64(end - start + 1),
+		ContentRange:  aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(data))),
+	}, nil
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+// listFiles returns the paths of the files under root, relative to it.
+func listFiles(t *testing.T, root string) []string {
+	var files []string
+	require.NoError(t, filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		files = append(files, rel)
+		return err
+	}))
+	sort.Strings(files)
+	return files
+}
+
+func TestDownloadFiles(t *testing.T) {
+	downloadRetryInterval = time.Millisecond
+	defer func() { downloadRetryInterval = time.Second }()
+	basePath := t.TempDir()
+	quarantinePath := t.TempDir()
+	existing := filepath.Join(basePath, "Project", "existing.mov")
+	require.NoError(t, os.MkdirAll(filepath.Dir(existing), 0775))
+	require.NoError(t, os.WriteFile(existing, []byte("local edit"), 0664))
+
+	store := &downloadObjectStore{
+		objects: map[string][]byte{
+			"Project/new.mov":      []byte("new clip"),
+			"Project/corrupt.mov":  []byte("corrupt clip"),
+			"Project/broken.mov":   []byte("broken clip"),
+			"Project/existing.mov": []byte("archived clip"),
+		},
+		corrupt: map[string]bool{"Project/corrupt.mov": true},
+		broken:  map[string]bool{"Project/broken.mov": true, "Project/existing.mov": true},
+	}
+	opts := DownloadOptions{
+		BasePath:       basePath,
+		FileOwnerUID:   os.Getuid(),
+		FileOwnerGID:   os.Getgid(),
+		QuarantinePath: quarantinePath,
+		ConflictPolicy: restoreTypes.ConflictPolicyOverwrite,
+		Workers:        2,
+	}
+	keys := []S3Entry{
+		{Bucket: "bucket1", Key: "Project/new.mov"},
+		{Bucket: "bucket1", Key: "Project/corrupt.mov"},
+		{Bucket: "bucket1", Key: "Project/broken.mov"},
+		{Bucket: "bucket1", Key: "Project/existing.mov"},
+	}
+
+	var recorded []FileResult
+	opts.OnResult = func(result FileResult) { recorded = append(recorded, result) }
+	results, err := DownloadFiles(context.Background(), store, keys, opts, nil)
+	require.NoError(t, err)
+	require.Len(t, results, 4)
+	assert.Len(t, recorded, 4)
+
+	byKey := make(map[string]FileResult)
+	for _, result := range results {
+		byKey[result.Key] = result
+	}
+	assert.NoError(t, byKey["Project/new.mov"].Err)
+	assert.Equal(t, VerifiedETag, byKey["Project/new.mov"].Verification)
+	assert.Error(t, byKey["Project/corrupt.mov"].Err)
+	assert.Equal(t, filepath.Join(quarantinePath, "Project", "corrupt.mov"), byKey["Project/corrupt.mov"].QuarantinePath)
+	assert.Error(t, byKey["Project/broken.mov"].Err)
+	assert.Error(t, byKey["Project/existing.mov"].Err)
+
+	// Only the verified download reaches its final path, failed downloads leave
+	// no temporary files and the file being overwritten is untouched
+	assert.Equal(t, []string{"Project/existing.mov", "Project/new.mov"}, listFiles(t, basePath))
+	data, err := os.ReadFile(filepath.Join(basePath, "Project", "new.mov"))
+	require.NoError(t, err)
+	assert.Equal(t, "new clip", string(data))
+	data, err = os.ReadFile(existing)
+	require.NoError(t, err)
+	assert.Equal(t, "local edit", string(data))
+	assert.Equal(t, []string{"Project/corrupt.mov"}, listFiles(t, quarantinePath))
+}
@@ -0,0 +1,206 @@
+package s3utils
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"golang.org/x/time/rate"
+)
+
+const (
+	restoreCompletedEvent = "ObjectRestore:Completed"
+
+	// Messages for other restores sharing the queue become visible again quickly
+	eventVisibilityTimeout = 30
+	eventWaitTimeSeconds   = 20
+	receiveRetryDelay      = 5 * time.Second
+
+	// staleEventAge is how long events for other restores are left on the queue.
+	// Each worker's HeadObject sweep finds its restored objects well within this,
+	// so older events are for restores that have finished or no longer need them
+	staleEventAge = 6 * time.Hour
+)
+
+// s3EventNotification is the subset of an S3 event notification message that
+// identifies the restored object.
+type s3EventNotification struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key string `json:"key"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// EventMonitor is a RestoreMonitor that consumes s3:ObjectRestore:Completed
+// events from an SQS queue. A HeadObject sweep runs when monitoring starts and
+// then every poll interval to catch objects whose events were missed.
+type EventMonitor struct {
+	queue    SQSClientInterface
+	queueURL string
+	client   S3ClientInterface
+	opts     MonitorOptions
+}
+
+func NewEventMonitor(queue SQSClientInterface, queueURL string, client S3ClientInterface, opts MonitorOptions) *EventMonitor {
+	return &EventMonitor{queue: queue, queueURL: queueURL, client: client, opts: opts.withDefaults()}
+}
+
+func (m *EventMonitor) Monitor(ctx context.Context, keys []S3Entry, restored chan<- S3Entry, onProgress ProgressFunc) error {
+	defer close(restored)
+
+	pending := make(map[S3Entry]bool, len(keys))
+	inManifest := make(map[S3Entry]bool, len(keys))
+	for _, key := range keys {
+		pending[key] = true
+		inManifest[key] = true
+	}
+	markRestored := func(entry S3Entry) {
+		if !pending[entry] {
+			return
+		}
+		delete(pending, entry)
+		log.Printf("Object %s/%s has been restored", entry.Bucket, entry.Key)
+		select {
+		case restored <- entry:
+		case <-ctx.Done():
+		}
+		if onProgress != nil {
+			onProgress(len(keys)-len(pending), len(keys))
+		}
+	}
+
+	log.Printf("Monitoring %d objects using restore events from %s", len(keys), m.queueURL)
+	limiter := rate.NewLimiter(rate.Limit(m.opts.HeadObjectRate), m.opts.Workers)
+	nextSweep := time.Now()
+	for len(pending) > 0 {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if !time.Now().Before(nextSweep) {
+			log.Printf("Checking restore status of %d objects", len(pending))
+			if _, err := pollRestoreStatus(ctx, m.client, pendingEntries(keys, pending), m.opts.Workers, limiter, markRestored); err != nil {
+				return err
+			}
+			nextSweep = time.Now().Add(m.opts.nextPollInterval())
+			continue
+		}
+
+		if err := m.receiveEvents(ctx, inManifest, markRestored); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("Error receiving restore events: %v", err)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(receiveRetryDelay):
+			}
+		}
+	}
+
+	log.Println("All objects restored successfully")
+	return nil
+}
+
+// receiveEvents handles one batch of messages. Messages about objects that are
+// not part of this restore are left on the queue for other workers until they
+// are stale. Messages that can't be parsed or hold no restore events, such as
+// s3:TestEvent, are deleted.
+func (m *EventMonitor) receiveEvents(ctx context.Context, inManifest map[S3Entry]bool, markRestored func(S3Entry)) error {
+	output, err := m.queue.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:                    aws.String(m.queueURL),
+		MaxNumberOfMessages:         10,
+		WaitTimeSeconds:             eventWaitTimeSeconds,
+		VisibilityTimeout:           eventVisibilityTimeout,
+		MessageSystemAttributeNames: []sqsTypes.MessageSystemAttributeName{sqsTypes.MessageSystemAttributeNameSentTimestamp},
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, message := range output.Messages {
+		entries, ok := parseRestoreEvent(aws.ToString(message.Body))
+		ours := ok
+		for _, entry := range entries {
+			if !inManifest[entry] {
+				ours = false
+			}
+		}
+		switch {
+		case ours:
+			for _, entry := range entries {
+				markRestored(entry)
+			}
+		case ok && len(entries) > 0 && !eventIsStale(message):
+			continue
+		}
+
+		if _, err := m.queue.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(m.queueURL),
+			ReceiptHandle: message.ReceiptHandle,
+		}); err != nil {
+			log.Printf("Error deleting restore event: %v", err)
+		}
+	}
+	return nil
+}
+
+// eventIsStale reports whether a message was sent more than staleEventAge ago.
+func eventIsStale(message sqsTypes.Message) bool {
+	sent, err := strconv.ParseInt(message.Attributes[string(sqsTypes.MessageSystemAttributeNameSentTimestamp)], 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Since(time.UnixMilli(sent)) > staleEventAge
+}
+
+// parseRestoreEvent returns the objects restored according to an S3 event
+// notification. ok is false if the message could not be understood. Messages
+// without restore events, such as s3:TestEvent, return no entries.
+func parseRestoreEvent(body string) (entries []S3Entry, ok bool) {
+	var notification s3EventNotification
+	if err := json.Unmarshal([]byte(body), &notification); err != nil {
+		log.Printf("Ignoring malformed restore event: %v", err)
+		return nil, false
+	}
+
+	for _, record := range notification.Records {
+		if !strings.HasPrefix(record.EventName, restoreCompletedEvent) {
+			continue
+		}
+		// Object keys in event notifications are URL encoded
+		key, err := url.QueryUnescape(record.S3.Object.Key)
+		if err != nil {
+			log.Printf("Ignoring restore event with invalid key %q: %v", record.S3.Object.Key, err)
+			return nil, false
+		}
+		entries = append(entries, S3Entry{Bucket: record.S3.Bucket.Name, Key: key})
+	}
+	return entries, true
+}
+
+// pendingEntries returns the keys still in pending, in manifest order.
+func pendingEntries(keys []S3Entry, pending map[S3Entry]bool) []S3Entry {
+	var entries []S3Entry
+	for _, key := range keys {
+		if pending[key] {
+			entries = append(entries, key)
+		}
+	}
+	return entries
+}
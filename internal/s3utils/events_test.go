@@ -0,0 +1,135 @@
+package s3utils
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqsTypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSQS is an in-memory queue. Received messages stay on the queue until they
+// are deleted and are delivered again on the next receive.
+type fakeSQS struct {
+	mu       sync.Mutex
+	messages map[string]string // receipt handle -> body
+	sentAt   map[string]time.Time
+	order    []string
+	deleted  []string
+}
+
+func newFakeSQS(bodies ...string) *fakeSQS {
+	f := &fakeSQS{messages: map[string]string{}, sentAt: map[string]time.Time{}}
+	for i, body := range bodies {
+		handle := fmt.Sprintf("handle-%d", i)
+		f.messages[handle] = body
+		f.order = append(f.order, handle)
+	}
+	return f
+}
+
+func (f *fakeSQS) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	output := &sqs.ReceiveMessageOutput{}
+	for _, handle := range f.order {
+		body, ok := f.messages[handle]
+		if !ok || len(output.Messages) == int(params.MaxNumberOfMessages) {
+			continue
+		}
+		message := sqsTypes.Message{Body: aws.String(body), ReceiptHandle: aws.String(handle)}
+		if sent, ok := f.sentAt[handle]; ok {
+			message.Attributes = map[string]string{"SentTimestamp": strconv.FormatInt(sent.UnixMilli(), 10)}
+		}
+		output.Messages = append(output.Messages, message)
+	}
+	return output, nil
+}
+
+func (f *fakeSQS) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	handle := aws.ToString(params.ReceiptHandle)
+	delete(f.messages, handle)
+	f.deleted = append(f.deleted, handle)
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func restoreCompletedMessage(bucket, key string) string {
+	return fmt.Sprintf(`{"Records":[{"eventName":"ObjectRestore:Completed","s3":{"bucket":{"name":%q},"object":{"key":%q}}}]}`, bucket, key)
+}
+
+func TestEventMonitor(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// The initial sweep finds a.mov already restored
+	mockS3Client := NewMockS3ClientInterface(mockCtrl)
+	mockS3Client.EXPECT().HeadObject(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			if aws.ToString(params.Key) == "project/a.mov" {
+				return &s3.HeadObjectOutput{StorageClass: types.StorageClassGlacier, Restore: aws.String(`ongoing-request="false"`)}, nil
+			}
+			return &s3.HeadObjectOutput{StorageClass: types.StorageClassGlacier, Restore: aws.String(`ongoing-request="true"`)}, nil
+		}).Times(3)
+
+	queue := newFakeSQS(
+		`{"Service":"Amazon S3","Event":"s3:TestEvent","Bucket":"bucket1"}`,
+		restoreCompletedMessage("bucket1", "project/my+clip.mov"),
+		restoreCompletedMessage("bucket1", "other-project/x.mov"),
+		restoreCompletedMessage("bucket1", "project/a.mov"),
+		restoreCompletedMessage("bucket2", "project/c.mov"),
+		"not json",
+		restoreCompletedMessage("bucket1", "finished-project/y.mov"),
+	)
+	queue.sentAt["handle-2"] = time.Now().Add(-time.Minute)
+	queue.sentAt["handle-6"] = time.Now().Add(-2 * staleEventAge)
+
+	keys := []S3Entry{
+		{Bucket: "bucket1", Key: "project/a.mov"},
+		{Bucket: "bucket1", Key: "project/my clip.mov"},
+		{Bucket: "bucket2", Key: "project/c.mov"},
+	}
+	monitor := NewEventMonitor(queue, "https://sqs.example/restore-events", mockS3Client, MonitorOptions{PollInterval: time.Hour})
+
+	restored := make(chan S3Entry, len(keys))
+	var progress []int
+	err := monitor.Monitor(context.Background(), keys, restored, func(done, total int) {
+		progress = append(progress, done)
+	})
+	assert.NoError(t, err)
+
+	var received []S3Entry
+	for entry := range restored {
+		received = append(received, entry)
+	}
+	assert.Equal(t, keys, received)
+	assert.Equal(t, []int{1, 2, 3}, progress)
+
+	// Recent events for other restores stay on the queue; stale and malformed ones are removed
+	assert.ElementsMatch(t, []string{"handle-0", "handle-1", "handle-3", "handle-4", "handle-5", "handle-6"}, queue.deleted)
+}
+
+func TestParseRestoreEvent(t *testing.T) {
+	entries, ok := parseRestoreEvent(restoreCompletedMessage("bucket1", "dir/file%281%29.mov"))
+	assert.True(t, ok)
+	assert.Equal(t, []S3Entry{{Bucket: "bucket1", Key: "dir/file(1).mov"}}, entries)
+
+	entries, ok = parseRestoreEvent(`{"Records":[{"eventName":"ObjectRestore:Post","s3":{"bucket":{"name":"bucket1"},"object":{"key":"a"}}}]}`)
+	assert.True(t, ok)
+	assert.Empty(t, entries)
+
+	_, ok = parseRestoreEvent("not json")
+	assert.False(t, ok)
+}
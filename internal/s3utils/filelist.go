@@ -0,0 +1,117 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+const fileLookupWorkers = 16
+
+// lookupFiles looks the requested keys up in the buckets in order. It returns
+// the files found that match filter, sorted by key, the keys ending in "/" as
+// folders to list, and the files found in no bucket.
+func lookupFiles(ctx context.Context, s3Client S3ClientInterface, buckets []string, keys []string, filter *keyFilter) (found []ManifestObject, folders []string, missing []string, err error) {
+	log.Printf("Looking up %d requested files in %d buckets", len(keys), len(buckets))
+
+	var files []string
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		if strings.HasSuffix(key, "/") {
+			folders = append(folders, key)
+		} else {
+			files = append(files, key)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	jobs := make(chan string)
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for w := 0; w < fileLookupWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				object, ok, err := headInBuckets(ctx, s3Client, buckets, key)
+				mu.Lock()
+				switch {
+				case err != nil:
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+				case !ok:
+					missing = append(missing, key)
+				case filter.matches(key, object.Size):
+					found = append(found, object)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, key := range files {
+		select {
+		case jobs <- key:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, nil, nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, nil, err
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].Key < found[j].Key })
+	sort.Strings(missing)
+	return found, folders, missing, nil
+}
+
+// headInBuckets returns the object for key from the first bucket that has it.
+func headInBuckets(ctx context.Context, s3Client S3ClientInterface, buckets []string, key string) (ManifestObject, bool, error) {
+	for _, bucket := range buckets {
+		head, err := s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		})
+		if isNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return ManifestObject{}, false, fmt.Errorf("failed to look up %s in bucket %s: %w", key, bucket, err)
+		}
+		return ManifestObject{
+			Bucket:       bucket,
+			Key:          key,
+			Size:         aws.ToInt64(head.ContentLength),
+			StorageClass: storageClassOf(string(head.StorageClass)),
+			LastModified: aws.ToTime(head.LastModified),
+		}, true, nil
+	}
+	return ManifestObject{}, false, nil
+}
+
+func isNotFound(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && (apiErr.ErrorCode() == "NotFound" || apiErr.ErrorCode() == "NoSuchKey")
+}
@@ -0,0 +1,62 @@
+package s3utils
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	restoreTypes "pluto-restore-assets/internal/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateCSVManifestFromFileList(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockS3Client := NewMockS3ClientInterface(mockCtrl)
+	tempDir := t.TempDir()
+
+	objects := map[string]*s3.HeadObjectOutput{
+		"bucket1/Card A/A001.mov": {ContentLength: aws.Int64(100), StorageClass: types.StorageClassDeepArchive},
+		"bucket2/Card A/A002.mov": {ContentLength: aws.Int64(200)},
+	}
+	mockS3Client.EXPECT().HeadObject(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+			if head, ok := objects[*params.Bucket+"/"+*params.Key]; ok {
+				return head, nil
+			}
+			return nil, &types.NotFound{}
+		}).AnyTimes()
+	mockS3Client.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+			output := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}
+			if *params.Bucket == "bucket1" && *params.Prefix == "Proxies/" {
+				output.Contents = []types.Object{{Key: aws.String("Proxies/A001.mov"), Size: aws.Int64(10)}}
+			}
+			return output, nil
+		}).AnyTimes()
+
+	params := restoreTypes.RestoreParams{
+		AssetBucketList:    []string{"bucket1", "bucket2"},
+		ManifestLocalPath:  filepath.Join(tempDir, "manifest.csv"),
+		AvailableLocalPath: filepath.Join(tempDir, "manifest_available.csv"),
+		Files:              []string{"Card A/A001.mov", "Card A/A002.mov", "Card A/A003.mov", "Card A/A001.mov", "Proxies/", "Graphics/"},
+	}
+	stats, err := GenerateCSVManifest(context.Background(), mockS3Client, params)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, stats.FileCount)
+	assert.Equal(t, int64(310), stats.TotalSize)
+	assert.Equal(t, []string{"Card A/A003.mov", "Graphics/"}, stats.MissingKeys)
+	assert.Equal(t, map[string]string{"Card A/A001.mov": "bucket1"}, readManifestMap(t, params.ManifestLocalPath))
+	assert.Equal(t, map[string]string{"Card A/A002.mov": "bucket2", "Proxies/A001.mov": "bucket1"}, readManifestMap(t, params.AvailableLocalPath))
+
+	// Nothing to restore if none of the files exist
+	params.Files = []string{"Card A/A003.mov"}
+	_, err = GenerateCSVManifest(context.Background(), mockS3Client, params)
+	assert.ErrorContains(t, err, "none of the 1 requested files")
+}
@@ -0,0 +1,87 @@
+package s3utils
+
+import (
+	"path"
+	"strings"
+
+	restoreTypes "pluto-restore-assets/internal/types"
+)
+
+// keyFilter applies a FileFilter to the keys listed under a restore prefix.
+type keyFilter struct {
+	restoreTypes.FileFilter
+	prefix     string
+	extensions map[string]bool
+}
+
+func newKeyFilter(filter restoreTypes.FileFilter, prefix string) *keyFilter {
+	f := &keyFilter{FileFilter: filter, prefix: prefix}
+	if len(filter.Extensions) > 0 {
+		f.extensions = make(map[string]bool, len(filter.Extensions))
+		for _, ext := range filter.Extensions {
+			f.extensions["."+strings.ToLower(strings.TrimPrefix(ext, "."))] = true
+		}
+	}
+	return f
+}
+
+// matches reports whether the object with the given key and size should be
+// restored.
+func (f *keyFilter) matches(key string, size int64) bool {
+	if f.MinSize > 0 && size < f.MinSize {
+		return false
+	}
+	if f.MaxSize > 0 && size > f.MaxSize {
+		return false
+	}
+	rel := strings.TrimPrefix(key, f.prefix)
+	if f.extensions != nil && !f.extensions[strings.ToLower(path.Ext(rel))] {
+		return false
+	}
+	if len(f.Include) > 0 && !matchesAny(f.Include, rel) {
+		return false
+	}
+	return !matchesAny(f.Exclude, rel)
+}
+
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches a relative path against a pattern. "**" matches any number
+// of folders and a pattern without a "/" is matched against the file name.
+func matchGlob(pattern, rel string) bool {
+	pattern = strings.Trim(pattern, "/")
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		matched, _ := path.Match(pattern, path.Base(rel))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Try every number of folders for the rest of the pattern to match
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], segments[0]); !matched {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+	return len(segments) == 0
+}
@@ -0,0 +1,102 @@
+package s3utils
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	restoreTypes "pluto-restore-assets/internal/types"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		want    bool
+	}{
+		{"*.mov", "clip.mov", true},
+		{"*.mov", "Card A/clip.mov", true},
+		{"*.mov", "clip.mxf", false},
+		{"Proxies/*", "Proxies/clip.mov", true},
+		{"Proxies/*", "Proxies/Day 1/clip.mov", false},
+		{"Proxies/**", "Proxies/Day 1/clip.mov", true},
+		{"/Proxies/**/", "Proxies/clip.mov", true},
+		{"**/RAW/**", "Camera/RAW/A001.R3D", true},
+		{"**/RAW/**", "RAW/A001.R3D", true},
+		{"**/RAW/**", "Camera/RAWS/A001.R3D", false},
+		{"Card ?/**/*.mxf", "Card B/Clips/001.mxf", true},
+		{"**", "anything/at/all", true},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, matchGlob(tt.pattern, tt.rel), "%s against %s", tt.pattern, tt.rel)
+	}
+}
+
+func TestKeyFilter(t *testing.T) {
+	filter := newKeyFilter(restoreTypes.FileFilter{
+		Include:    []string{"Camera/**", "Proxies/**"},
+		Exclude:    []string{"**/RAW/**"},
+		Extensions: []string{"MOV", ".mxf"},
+		MinSize:    10,
+		MaxSize:    1000,
+	}, "project/Assets/")
+
+	assert.True(t, filter.matches("project/Assets/Camera/A001.mov", 100))
+	assert.True(t, filter.matches("project/Assets/Proxies/A001.MXF", 100))
+	assert.False(t, filter.matches("project/Assets/Audio/A001.mov", 100), "not included")
+	assert.False(t, filter.matches("project/Assets/Camera/RAW/A001.mov", 100), "excluded")
+	assert.False(t, filter.matches("project/Assets/Camera/A001.wav", 100), "extension")
+	assert.False(t, filter.matches("project/Assets/Camera/A001.mov", 5), "too small")
+	assert.False(t, filter.matches("project/Assets/Camera/A001.mov", 5000), "too large")
+
+	// An empty filter restores everything
+	assert.True(t, newKeyFilter(restoreTypes.FileFilter{}, "project/Assets/").matches("project/Assets/any/thing", 0))
+}
+
+func TestFileFilterValidate(t *testing.T) {
+	assert.NoError(t, restoreTypes.FileFilter{Include: []string{"**/*.mov"}, MinSize: 1, MaxSize: 2}.Validate())
+	assert.Error(t, restoreTypes.FileFilter{Exclude: []string{"[a-"}}.Validate())
+	assert.Error(t, restoreTypes.FileFilter{Include: []string{""}}.Validate())
+	assert.Error(t, restoreTypes.FileFilter{MinSize: 10, MaxSize: 5}.Validate())
+	assert.Error(t, restoreTypes.FileFilter{MinSize: -1}.Validate())
+}
+
+func TestGenerateCSVManifestWithFilter(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	mockS3Client := NewMockS3ClientInterface(mockCtrl)
+	tempDir := t.TempDir()
+
+	mockS3Client.EXPECT().ListObjectsV2(gomock.Any(), gomock.Any(), gomock.Any()).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("project/Assets/Proxies/a.mov"), Size: aws.Int64(100), StorageClass: types.ObjectStorageClassDeepArchive},
+			{Key: aws.String("project/Assets/Proxies/b.mov"), Size: aws.Int64(200)},
+			{Key: aws.String("project/Assets/RAW/a.r3d"), Size: aws.Int64(5000), StorageClass: types.ObjectStorageClassDeepArchive},
+		},
+		IsTruncated: aws.Bool(false),
+	}, nil)
+
+	params := restoreTypes.RestoreParams{
+		AssetBucketList:    []string{"bucket1"},
+		RestorePath:        "project/Assets/",
+		ManifestLocalPath:  filepath.Join(tempDir, "manifest.csv"),
+		AvailableLocalPath: filepath.Join(tempDir, "manifest_available.csv"),
+		Filter:             restoreTypes.FileFilter{Exclude: []string{"RAW/**"}},
+	}
+	stats, err := GenerateCSVManifest(context.Background(), mockS3Client, params)
+	assert.NoError(t, err)
+
+	// Costs are estimated from exactly the filtered set
+	assert.Equal(t, 2, stats.FileCount)
+	assert.Equal(t, int64(300), stats.TotalSize)
+	assert.Equal(t, &StorageClassStats{FileCount: 1, TotalSize: 100}, stats.StorageClasses["DEEP_ARCHIVE"])
+	assert.Equal(t, map[string]string{"project/Assets/Proxies/a.mov": "bucket1"}, readManifestMap(t, params.ManifestLocalPath))
+	assert.Equal(t, map[string]string{"project/Assets/Proxies/b.mov": "bucket1"}, readManifestMap(t, params.AvailableLocalPath))
+}
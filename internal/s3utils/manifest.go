@@ -1,78 +1,279 @@
 package s3utils
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/csv"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"time"
+
 	restoreTypes "pluto-restore-assets/internal/types"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 type ManifestStats struct {
+	FileCount          int
+	TotalSize          int64
+	RestoreFileCount   int
+	AvailableFileCount int
+	StorageClasses     map[string]*StorageClassStats
+	MissingKeys        []string // requested files that weren't found
+	PresentFileCount   int      // files already on disk, left out of the manifests
+	PresentSize        int64
+}
+
+type StorageClassStats struct {
 	FileCount int
 	TotalSize int64
 }
 
+// ManifestObject is an object selected for a restore.
+type ManifestObject struct {
+	Bucket       string    `json:"bucket"`
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	StorageClass string    `json:"storageClass"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// storageClassOf normalises the storage class reported by ListObjectsV2, which
+// leaves it empty for STANDARD objects in some cases.
+func storageClassOf(class string) string {
+	if class == "" {
+		return string(types.ObjectStorageClassStandard)
+	}
+	return class
+}
+
+func (s *ManifestStats) add(obj ManifestObject) {
+	s.FileCount++
+	s.TotalSize += obj.Size
+	if RequiresRestore(obj.StorageClass) {
+		s.RestoreFileCount++
+	} else {
+		s.AvailableFileCount++
+	}
+
+	if s.StorageClasses == nil {
+		s.StorageClasses = make(map[string]*StorageClassStats)
+	}
+	classStats, ok := s.StorageClasses[obj.StorageClass]
+	if !ok {
+		classStats = &StorageClassStats{}
+		s.StorageClasses[obj.StorageClass] = classStats
+	}
+	classStats.FileCount++
+	classStats.TotalSize += obj.Size
+}
+
+// GenerateCSVManifest writes the manifests of the objects to restore, either
+// everything under params.RestorePath or, when params.Files is set, just those
+// keys. Files that can't be found in any bucket are returned in MissingKeys.
+// Objects are streamed to the manifests in key order, so memory use doesn't
+// grow with the size of the project and the output is always the same.
 func GenerateCSVManifest(ctx context.Context, s3Client S3ClientInterface, params restoreTypes.RestoreParams) (*ManifestStats, error) {
 	log.Printf("Generating CSV manifest for params: %+v", params)
-	if params.RestorePath == "" || params.RestorePath == "/" {
-		return nil, fmt.Errorf("invalid prefix: prefix is empty")
+
+	restoreManifest, err := newManifestWriter(params.ManifestLocalPath)
+	if err != nil {
+		return nil, err
 	}
+	defer restoreManifest.Close()
 
+	var availableManifest *manifestWriter
+	if params.AvailableLocalPath != "" {
+		if availableManifest, err = newManifestWriter(params.AvailableLocalPath); err != nil {
+			return nil, err
+		}
+		defer availableManifest.Close()
+	}
+
+	// Only archived objects go to the batch job; restoring anything else fails
+	stats, err := streamManifestObjects(ctx, s3Client, params, func(object ManifestObject) error {
+		entry := S3Entry{Bucket: object.Bucket, Key: object.Key}
+		if RequiresRestore(object.StorageClass) {
+			return restoreManifest.Write(entry)
+		}
+		return availableManifest.Write(entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := restoreManifest.Close(); err != nil {
+		return nil, err
+	}
+	if err := availableManifest.Close(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Generated manifest with %d unique objects from %d buckets (%d to restore, %d already available)",
+		stats.FileCount, len(params.AssetBucketList), stats.RestoreFileCount, stats.AvailableFileCount)
+	log.Printf("Stats: %+v", stats)
+	return stats, nil
+}
+
+// PreviewManifest calls visit, in key order, for each object GenerateCSVManifest
+// would write, without writing anything or holding the listing in memory.
+func PreviewManifest(ctx context.Context, s3Client S3ClientInterface, params restoreTypes.RestoreParams, visit func(ManifestObject) error) (*ManifestStats, error) {
+	return streamManifestObjects(ctx, s3Client, params, visit)
+}
+
+// streamManifestObjects calls emit, in key order, for each object selected by
+// params that isn't already present locally. It's not an error for every object
+// to be present already; FileCount is then 0.
+func streamManifestObjects(ctx context.Context, s3Client S3ClientInterface, params restoreTypes.RestoreParams, emit func(ManifestObject) error) (*ManifestStats, error) {
+	filter := newKeyFilter(params.Filter, params.RestorePath)
 	stats := &ManifestStats{}
-	uniqueKeys := make(map[string]string)
 
-	for _, bucket := range params.AssetBucketList {
-		log.Printf("Checking bucket: %s for prefix: %s", bucket, params.RestorePath)
+	var objects objectIterator
+	var folders []string
+	var folderListings []*mergeIterator
+	if len(params.Files) > 0 {
+		files, requestedFolders, missing, err := lookupFiles(ctx, s3Client, params.AssetBucketList, params.Files, filter)
+		if err != nil {
+			return nil, err
+		}
+		stats.MissingKeys = missing
+		folders = requestedFolders
 
-		input := &s3.ListObjectsV2Input{
-			Bucket: aws.String(bucket),
-			Prefix: aws.String(params.RestorePath),
+		sources := []objectIterator{&sliceIterator{objects: files}}
+		for _, folder := range folders {
+			listing := listPrefix(s3Client, params.AssetBucketList, folder, filter)
+			folderListings = append(folderListings, listing)
+			sources = append(sources, listing)
 		}
+		objects = newMergeIterator(sources...)
+	} else {
+		if params.RestorePath == "" || params.RestorePath == "/" {
+			return nil, fmt.Errorf("invalid prefix: prefix is empty")
+		}
+		objects = listPrefix(s3Client, params.AssetBucketList, params.RestorePath, filter)
+	}
 
-		paginator := s3.NewListObjectsV2Paginator(s3Client, input)
+	// Files already on disk aren't restored again, unless they are to be overwritten
+	var present *presentFiles
+	if params.BasePath != "" && restoreTypes.ConflictPolicy(params.ConflictPolicy) != restoreTypes.ConflictPolicyOverwrite {
+		var err error
+		if present, err = newPresentFiles(params); err != nil {
+			return nil, err
+		}
+	}
 
-		for paginator.HasMorePages() {
-			output, err := paginator.NextPage(ctx)
-			if err != nil {
-				return nil, fmt.Errorf("failed to list objects in bucket %s: %w", bucket, err)
-			}
+	found := 0
+	for {
+		object, ok, err := objects.next(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		found++
+		if present.contains(object) {
+			stats.PresentFileCount++
+			stats.PresentSize += object.Size
+			continue
+		}
+		stats.add(object)
+		if err := emit(object); err != nil {
+			return nil, err
+		}
+	}
 
-			for _, obj := range output.Contents {
-				if _, exists := uniqueKeys[*obj.Key]; !exists {
-					uniqueKeys[*obj.Key] = bucket
-					stats.FileCount++
-					stats.TotalSize += *obj.Size
-				}
+	if len(params.Files) > 0 {
+		for i, folder := range folders {
+			if folderListings[i].count == 0 {
+				stats.MissingKeys = append(stats.MissingKeys, folder)
 			}
 		}
+		sort.Strings(stats.MissingKeys)
+		if len(stats.MissingKeys) > 0 {
+			log.Printf("%d of %d requested files were not found", len(stats.MissingKeys), len(params.Files))
+		}
+	}
+
+	switch {
+	case found == 0 && len(params.Files) > 0:
+		return nil, fmt.Errorf("none of the %d requested files were found in any bucket", len(params.Files))
+	case found == 0:
+		return nil, fmt.Errorf("no objects found in any bucket with prefix %s matching the filter", params.RestorePath)
+	}
+	if stats.PresentFileCount > 0 {
+		log.Printf("%d files (%d bytes) are already present under %s", stats.PresentFileCount, stats.PresentSize, params.BasePath)
 	}
+	return stats, nil
+}
 
-	if len(uniqueKeys) == 0 {
-		return nil, fmt.Errorf("no objects found in any bucket with prefix: %s", params.RestorePath)
+// RequiresRestore reports whether objects of the given storage class must be
+// restored before they can be downloaded. INTELLIGENT_TIERING objects are
+// treated as available as their access tier is not visible when listing.
+func RequiresRestore(storageClass string) bool {
+	switch types.ObjectStorageClass(storageClass) {
+	case types.ObjectStorageClassGlacier, types.ObjectStorageClassDeepArchive:
+		return true
 	}
+	return false
+}
+
+// manifestWriter writes a manifest CSV, gzipped if its path ends in ".gz". A nil
+// manifestWriter discards what is written to it.
+type manifestWriter struct {
+	file   *os.File
+	gzip   *gzip.Writer
+	csv    *csv.Writer
+	closed bool
+}
 
-	file, err := os.Create(params.ManifestLocalPath)
+func newManifestWriter(path string) (*manifestWriter, error) {
+	file, err := os.Create(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create manifest file: %w", err)
 	}
-	defer file.Close()
+	w := &manifestWriter{file: file}
+	var out io.Writer = file
+	if strings.HasSuffix(path, ".gz") {
+		w.gzip = gzip.NewWriter(file)
+		out = w.gzip
+	}
+	w.csv = csv.NewWriter(out)
+	return w, nil
+}
+
+func (w *manifestWriter) Write(entry S3Entry) error {
+	if w == nil {
+		return nil
+	}
+	if err := w.csv.Write([]string{entry.Bucket, entry.Key}); err != nil {
+		return fmt.Errorf("failed to write to CSV: %w", err)
+	}
+	return nil
+}
 
-	writer := csv.NewWriter(file)
-	defer writer.Flush()
+// Close flushes the manifest to disk. Closing it again does nothing.
+func (w *manifestWriter) Close() error {
+	if w == nil || w.closed {
+		return nil
+	}
+	w.closed = true
 
-	for key, bucket := range uniqueKeys {
-		if err := writer.Write([]string{bucket, key}); err != nil {
-			return nil, fmt.Errorf("failed to write to CSV: %w", err)
+	w.csv.Flush()
+	err := w.csv.Error()
+	if w.gzip != nil {
+		if gzipErr := w.gzip.Close(); err == nil {
+			err = gzipErr
 		}
 	}
-
-	log.Printf("Generated manifest with %d unique objects from %d buckets",
-		len(uniqueKeys), len(params.AssetBucketList))
-	log.Printf("Stats: %+v", stats)
-	return stats, nil
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write manifest file: %w", err)
+	}
+	return nil
 }
@@ -4,8 +4,13 @@ package s3utils
 
 import (
 	"context"
+	"fmt"
+	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -30,18 +35,21 @@ func TestGenerateCSVManifest(t *testing.T) {
 	defer os.RemoveAll(tempDir)
 
 	testCases := []struct {
-		name          string
-		params        restoreTypes.RestoreParams
-		setup         func()
-		expectedFiles map[string]string // key -> bucket
-		expectError   bool
+		name              string
+		params            restoreTypes.RestoreParams
+		setup             func()
+		expectedFiles     map[string]string // key -> bucket
+		expectedAvailable map[string]string
+		expectedStats     map[string]*StorageClassStats
+		expectError       bool
 	}{
 		{
 			name: "Files in first bucket only",
 			params: restoreTypes.RestoreParams{
-				AssetBucketList:   []string{"bucket1", "bucket2"},
-				RestorePath:       "test-prefix/",
-				ManifestLocalPath: filepath.Join(tempDir, "manifest1.csv"),
+				AssetBucketList:    []string{"bucket1", "bucket2"},
+				RestorePath:        "test-prefix/",
+				ManifestLocalPath:  filepath.Join(tempDir, "manifest1.csv"),
+				AvailableLocalPath: filepath.Join(tempDir, "manifest1_available.csv"),
 			},
 			setup: func() {
 				// First bucket call
@@ -77,16 +85,22 @@ func TestGenerateCSVManifest(t *testing.T) {
 					IsTruncated: aws.Bool(false),
 				}, nil)
 			},
-			expectedFiles: map[string]string{
+			// Standard objects need no restore
+			expectedFiles: map[string]string{},
+			expectedAvailable: map[string]string{
 				"test-prefix/file1.txt": "bucket1",
 			},
+			expectedStats: map[string]*StorageClassStats{
+				"STANDARD": {FileCount: 1, TotalSize: 100},
+			},
 		},
 		{
 			name: "Files in both buckets with overlap",
 			params: restoreTypes.RestoreParams{
-				AssetBucketList:   []string{"bucket1", "bucket2"},
-				RestorePath:       "test-prefix/",
-				ManifestLocalPath: filepath.Join(tempDir, "manifest2.csv"),
+				AssetBucketList:    []string{"bucket1", "bucket2"},
+				RestorePath:        "test-prefix/",
+				ManifestLocalPath:  filepath.Join(tempDir, "manifest2.csv"),
+				AvailableLocalPath: filepath.Join(tempDir, "manifest2_available.csv"),
 			},
 			setup: func() {
 				// First bucket call
@@ -122,8 +136,9 @@ func TestGenerateCSVManifest(t *testing.T) {
 				).Return(&s3.ListObjectsV2Output{
 					Contents: []types.Object{
 						{
-							Key:  aws.String("test-prefix/file2.txt"),
-							Size: aws.Int64(100),
+							Key:          aws.String("test-prefix/file2.txt"),
+							Size:         aws.Int64(100),
+							StorageClass: types.ObjectStorageClassDeepArchive,
 						},
 						{
 							Key:  aws.String("test-prefix/shared.txt"),
@@ -134,10 +149,16 @@ func TestGenerateCSVManifest(t *testing.T) {
 				}, nil)
 			},
 			expectedFiles: map[string]string{
+				"test-prefix/file2.txt": "bucket2",
+			},
+			expectedAvailable: map[string]string{
 				"test-prefix/file1.txt":  "bucket1",
-				"test-prefix/file2.txt":  "bucket2",
 				"test-prefix/shared.txt": "bucket1", // First bucket takes precedence
 			},
+			expectedStats: map[string]*StorageClassStats{
+				"STANDARD":     {FileCount: 2, TotalSize: 200},
+				"DEEP_ARCHIVE": {FileCount: 1, TotalSize: 100},
+			},
 		},
 	}
 
@@ -154,25 +175,159 @@ func TestGenerateCSVManifest(t *testing.T) {
 
 			assert.NoError(t, err)
 			assert.NotNil(t, stats)
+			assert.Equal(t, tc.expectedStats, stats.StorageClasses)
 
 			// Verify the manifest contents
-			content, err := os.ReadFile(tc.params.ManifestLocalPath)
-			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedFiles, readManifestMap(t, tc.params.ManifestLocalPath))
+			assert.Equal(t, tc.expectedAvailable, readManifestMap(t, tc.params.AvailableLocalPath))
+			assert.Equal(t, len(tc.expectedFiles), stats.RestoreFileCount)
+			assert.Equal(t, len(tc.expectedAvailable), stats.AvailableFileCount)
+		})
+	}
+}
+
+// readManifestMap converts CSV content to a key -> bucket map for easy comparison
+func readManifestMap(t *testing.T, path string) map[string]string {
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	lines := strings.Split(string(content), "\n")
+	resultMap := make(map[string]string)
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, ",")
+		if len(parts) == 2 {
+			resultMap[parts[1]] = parts[0]
+		}
+	}
+	return resultMap
+}
+
+// pagedListClient lists generated objects a page at a time, as S3 does.
+type pagedListClient struct {
+	objects  map[string][]types.Object // bucket -> objects sorted by key
+	pageSize int
+}
 
-			// Convert CSV content to map for easy comparison
-			lines := strings.Split(string(content), "\n")
-			resultMap := make(map[string]string)
-			for _, line := range lines {
-				if line == "" {
-					continue
-				}
-				parts := strings.Split(line, ",")
-				if len(parts) == 2 {
-					resultMap[parts[1]] = parts[0]
-				}
+func newPagedListClient(pageSize int, counts map[string]int) *pagedListClient {
+	c := &pagedListClient{objects: make(map[string][]types.Object), pageSize: pageSize}
+	for bucket, count := range counts {
+		objects := make([]types.Object, count)
+		for i := range objects {
+			class := types.ObjectStorageClassDeepArchive
+			if i%4 == 0 {
+				class = types.ObjectStorageClassStandard
+			}
+			objects[i] = types.Object{
+				Key:          aws.String(fmt.Sprintf("project/Assets/clip%07d.mov", i)),
+				Size:         aws.Int64(int64(i)),
+				StorageClass: class,
 			}
+		}
+		c.objects[bucket] = objects
+	}
+	return c
+}
 
-			assert.Equal(t, tc.expectedFiles, resultMap)
-		})
+func (c *pagedListClient) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	objects := c.objects[aws.ToString(params.Bucket)]
+	start := 0
+	if params.ContinuationToken != nil {
+		start, _ = strconv.Atoi(*params.ContinuationToken)
+	}
+	end := min(start+c.pageSize, len(objects))
+	output := &s3.ListObjectsV2Output{Contents: objects[start:end], IsTruncated: aws.Bool(end < len(objects))}
+	if end < len(objects) {
+		output.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	return output, nil
+}
+
+func (c *pagedListClient) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	return nil, &types.NotFound{}
+}
+
+func TestGenerateCSVManifestIsSorted(t *testing.T) {
+	client := newPagedListClient(7, map[string]int{"bucket1": 50, "bucket2": 80})
+	tempDir := t.TempDir()
+	params := restoreTypes.RestoreParams{
+		AssetBucketList:    []string{"bucket1", "bucket2"},
+		RestorePath:        "project/Assets/",
+		ManifestLocalPath:  filepath.Join(tempDir, "manifest.csv"),
+		AvailableLocalPath: filepath.Join(tempDir, "manifest_available.csv.gz"),
+	}
+
+	stats, err := GenerateCSVManifest(context.Background(), client, params)
+	assert.NoError(t, err)
+	assert.Equal(t, 80, stats.FileCount)
+	assert.Equal(t, 60, stats.RestoreFileCount)
+
+	first, err := os.ReadFile(params.ManifestLocalPath)
+	assert.NoError(t, err)
+	restoreEntries, err := LoadManifest(params.ManifestLocalPath)
+	assert.NoError(t, err)
+	availableEntries, err := LoadManifest(params.AvailableLocalPath)
+	assert.NoError(t, err)
+	assert.Len(t, restoreEntries, 60)
+	assert.Len(t, availableEntries, 20)
+	compressed, err := os.ReadFile(params.AvailableLocalPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x1f, 0x8b}, compressed[:2])
+
+	// Keys are written once, in order, from the first bucket that has them
+	entries := append(restoreEntries, availableEntries...)
+	for _, list := range [][]S3Entry{restoreEntries, availableEntries} {
+		assert.True(t, sort.SliceIsSorted(list, func(i, j int) bool { return list[i].Key < list[j].Key }))
+	}
+	for _, entry := range entries {
+		index, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(entry.Key, "project/Assets/clip"), ".mov"))
+		if index < 50 {
+			assert.Equal(t, "bucket1", entry.Bucket, entry.Key)
+		} else {
+			assert.Equal(t, "bucket2", entry.Bucket, entry.Key)
+		}
+	}
+
+	// Generating it again gives exactly the same manifest
+	_, err = GenerateCSVManifest(context.Background(), client, params)
+	assert.NoError(t, err)
+	second, err := os.ReadFile(params.ManifestLocalPath)
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+}
+
+func TestGenerateCSVManifestRejectsUnsortedListing(t *testing.T) {
+	client := newPagedListClient(2, map[string]int{"bucket1": 5})
+	objects := client.objects["bucket1"]
+	objects[1], objects[3] = objects[3], objects[1]
+
+	_, err := GenerateCSVManifest(context.Background(), client, restoreTypes.RestoreParams{
+		AssetBucketList:   []string{"bucket1"},
+		RestorePath:       "project/Assets/",
+		ManifestLocalPath: filepath.Join(t.TempDir(), "manifest.csv"),
+	})
+	assert.ErrorContains(t, err, "listing is not sorted")
+}
+
+func BenchmarkGenerateCSVManifest(b *testing.B) {
+	client := newPagedListClient(1000, map[string]int{"bucket1": 200000, "bucket2": 100000, "bucket3": 250000})
+	tempDir := b.TempDir()
+	params := restoreTypes.RestoreParams{
+		AssetBucketList:    []string{"bucket1", "bucket2", "bucket3"},
+		RestorePath:        "project/Assets/",
+		ManifestLocalPath:  filepath.Join(tempDir, "manifest.csv"),
+		AvailableLocalPath: filepath.Join(tempDir, "manifest_available.csv.gz"),
+	}
+
+	log.SetOutput(io.Discard)
+	b.Cleanup(func() { log.SetOutput(os.Stderr) })
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := GenerateCSVManifest(context.Background(), client, params); err != nil {
+			b.Fatal(err)
+		}
 	}
 }
@@ -0,0 +1,179 @@
+package s3utils
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// objectIterator yields manifest objects in key order.
+type objectIterator interface {
+	// next returns the next object, or false once there are none left.
+	next(ctx context.Context) (ManifestObject, bool, error)
+}
+
+// listingIterator pages through the objects under a prefix in one bucket that
+// match a filter. S3 lists keys in UTF-8 binary order, which is Go's string
+// order, so only the current page is held in memory.
+type listingIterator struct {
+	bucket    string
+	filter    *keyFilter
+	paginator *s3.ListObjectsV2Paginator
+	page      []types.Object
+	lastKey   string
+}
+
+func newListingIterator(s3Client S3ClientInterface, bucket, prefix string, filter *keyFilter) *listingIterator {
+	log.Printf("Checking bucket: %s for prefix: %s", bucket, prefix)
+	return &listingIterator{
+		bucket: bucket,
+		filter: filter,
+		paginator: s3.NewListObjectsV2Paginator(s3Client, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		}),
+	}
+}
+
+func (it *listingIterator) next(ctx context.Context) (ManifestObject, bool, error) {
+	for {
+		for len(it.page) > 0 {
+			obj := it.page[0]
+			it.page = it.page[1:]
+
+			key := aws.ToString(obj.Key)
+			// Merging and deduplicating rely on the listing order
+			if key < it.lastKey {
+				return ManifestObject{}, false, fmt.Errorf("bucket %s listed %s after %s: listing is not sorted", it.bucket, key, it.lastKey)
+			}
+			it.lastKey = key
+
+			if !it.filter.matches(key, aws.ToInt64(obj.Size)) {
+				continue
+			}
+			return ManifestObject{
+				Bucket:       it.bucket,
+				Key:          key,
+				Size:         aws.ToInt64(obj.Size),
+				StorageClass: storageClassOf(string(obj.StorageClass)),
+				LastModified: aws.ToTime(obj.LastModified),
+			}, true, nil
+		}
+
+		if !it.paginator.HasMorePages() {
+			return ManifestObject{}, false, nil
+		}
+		output, err := it.paginator.NextPage(ctx)
+		if err != nil {
+			return ManifestObject{}, false, fmt.Errorf("failed to list objects in bucket %s: %w", it.bucket, err)
+		}
+		it.page = output.Contents
+	}
+}
+
+// sliceIterator yields objects already sorted by key.
+type sliceIterator struct {
+	objects []ManifestObject
+}
+
+func (it *sliceIterator) next(context.Context) (ManifestObject, bool, error) {
+	if len(it.objects) == 0 {
+		return ManifestObject{}, false, nil
+	}
+	object := it.objects[0]
+	it.objects = it.objects[1:]
+	return object, true, nil
+}
+
+// mergeIterator merges sorted iterators into one, yielding each key once from
+// the first iterator that has it. Only the next object of each source is held,
+// so memory doesn't grow with the number of objects.
+type mergeIterator struct {
+	sources []objectIterator
+	heads   mergeHeap
+	started bool
+	lastKey string
+	count   int // objects yielded so far
+}
+
+func newMergeIterator(sources ...objectIterator) *mergeIterator {
+	return &mergeIterator{sources: sources}
+}
+
+// listPrefix returns an iterator over the objects under prefix that match
+// filter. An object in more than one bucket is taken from the first.
+func listPrefix(s3Client S3ClientInterface, buckets []string, prefix string, filter *keyFilter) *mergeIterator {
+	sources := make([]objectIterator, len(buckets))
+	for i, bucket := range buckets {
+		sources[i] = newListingIterator(s3Client, bucket, prefix, filter)
+	}
+	return newMergeIterator(sources...)
+}
+
+func (m *mergeIterator) next(ctx context.Context) (ManifestObject, bool, error) {
+	if !m.started {
+		m.started = true
+		for i, source := range m.sources {
+			object, ok, err := source.next(ctx)
+			if err != nil {
+				return ManifestObject{}, false, err
+			}
+			if ok {
+				m.heads = append(m.heads, mergeHead{object: object, source: i})
+			}
+		}
+		heap.Init(&m.heads)
+	}
+
+	for len(m.heads) > 0 {
+		head := m.heads[0]
+		object, ok, err := m.sources[head.source].next(ctx)
+		if err != nil {
+			return ManifestObject{}, false, err
+		}
+		if ok {
+			m.heads[0] = mergeHead{object: object, source: head.source}
+			heap.Fix(&m.heads, 0)
+		} else {
+			heap.Pop(&m.heads)
+		}
+
+		// Equal keys come out in source order, so later copies are dropped
+		if m.count > 0 && head.object.Key == m.lastKey {
+			continue
+		}
+		m.lastKey = head.object.Key
+		m.count++
+		return head.object, true, nil
+	}
+	return ManifestObject{}, false, nil
+}
+
+type mergeHead struct {
+	object ManifestObject
+	source int
+}
+
+// mergeHeap orders the sources' next objects by key, then by source.
+type mergeHeap []mergeHead
+
+func (h mergeHeap) Len() int { return len(h) }
+func (h mergeHeap) Less(i, j int) bool {
+	if h[i].object.Key != h[j].object.Key {
+		return h[i].object.Key < h[j].object.Key
+	}
+	return h[i].source < h[j].source
+}
+func (h mergeHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeHead)) }
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	head := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return head
+}
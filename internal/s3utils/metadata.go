@@ -0,0 +1,121 @@
+package s3utils
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// User metadata keys archivers store file attributes under, without the
+// x-amz-meta- prefix. s3cmd stores them all in one "s3cmd-attrs" value.
+const (
+	metadataMtime       = "mtime"
+	metadataAtime       = "atime"
+	metadataMode        = "mode"
+	metadataS3cmdAttrs  = "s3cmd-attrs"
+	metadataXattrPrefix = "xattr-"
+)
+
+// fileMetadata returns the user metadata of an object, with s3cmd's combined
+// attributes split into their own keys.
+func fileMetadata(head *s3.HeadObjectOutput) map[string]string {
+	metadata := make(map[string]string, len(head.Metadata))
+	for key, value := range head.Metadata {
+		metadata[strings.ToLower(key)] = value
+	}
+	if attrs, ok := metadata[metadataS3cmdAttrs]; ok {
+		for _, attr := range strings.Split(attrs, "/") {
+			if key, value, ok := strings.Cut(attr, ":"); ok {
+				if _, exists := metadata[key]; !exists {
+					metadata[key] = value
+				}
+			}
+		}
+	}
+	return metadata
+}
+
+// parseMetadataTime parses a time stored as Unix seconds, possibly fractional,
+// or as RFC 3339.
+func parseMetadataTime(value string) (time.Time, bool) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		whole := int64(seconds)
+		return time.Unix(whole, int64((seconds-float64(whole))*1e9)), true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// originalTimes returns the modification and access times a restored file
+// should have: those stored by the archiver if any, otherwise LastModified.
+func originalTimes(head *s3.HeadObjectOutput) (mtime, atime time.Time) {
+	metadata := fileMetadata(head)
+	mtime = aws.ToTime(head.LastModified)
+	if t, ok := parseMetadataTime(metadata[metadataMtime]); ok {
+		mtime = t
+	}
+	atime = mtime
+	if t, ok := parseMetadataTime(metadata[metadataAtime]); ok {
+		atime = t
+	}
+	return mtime, atime
+}
+
+// parseMode parses permissions stored in octal, such as "0644", or as a decimal
+// st_mode as s3cmd does. Only the permission bits are kept.
+func parseMode(value string) (os.FileMode, bool) {
+	base := 10
+	if strings.HasPrefix(value, "0") {
+		base = 8
+	}
+	mode, err := strconv.ParseUint(value, base, 32)
+	if err != nil {
+		return 0, false
+	}
+	return os.FileMode(mode).Perm(), true
+}
+
+// applyMetadata sets the original times of an object on its downloaded file,
+// and when preserveAttributes is set, also its stored permissions and extended
+// attributes. Extended attributes are best effort, as not every filesystem
+// supports them.
+func applyMetadata(path string, head *s3.HeadObjectOutput, preserveAttributes bool) error {
+	if preserveAttributes {
+		metadata := fileMetadata(head)
+		if value, ok := metadata[metadataMode]; ok {
+			if mode, ok := parseMode(value); ok {
+				if err := os.Chmod(path, mode); err != nil {
+					return fmt.Errorf("failed to set permissions on %s: %w", path, err)
+				}
+			} else {
+				log.Printf("Ignoring invalid mode %q for %s", value, path)
+			}
+		}
+		for key, value := range metadata {
+			name, ok := strings.CutPrefix(key, metadataXattrPrefix)
+			if !ok {
+				continue
+			}
+			if err := setXattr(path, name, value); err != nil {
+				log.Printf("Failed to set extended attribute %s on %s: %v", name, path, err)
+			}
+		}
+	}
+
+	mtime, atime := originalTimes(head)
+	if mtime.IsZero() {
+		return nil
+	}
+	if err := os.Chtimes(path, atime, mtime); err != nil {
+		return fmt.Errorf("failed to set times on %s: %w", path, err)
+	}
+	return nil
+}
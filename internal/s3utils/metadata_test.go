@@ -0,0 +1,84 @@
+package s3utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOriginalTimes(t *testing.T) {
+	lastModified := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	archived := time.Date(2019, 6, 15, 8, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name          string
+		metadata      map[string]string
+		expectedMtime time.Time
+		expectedAtime time.Time
+	}{
+		{"last modified", nil, lastModified, lastModified},
+		{"unix seconds", map[string]string{"mtime": "1560587400"}, archived, archived},
+		{"fractional seconds", map[string]string{"Mtime": "1560587400.5"}, archived.Add(500 * time.Millisecond), archived.Add(500 * time.Millisecond)},
+		{"rfc3339", map[string]string{"mtime": "2019-06-15T08:30:00Z", "atime": "2024-01-01T00:00:00Z"}, archived, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"s3cmd", map[string]string{"s3cmd-attrs": "atime:1560587400/gid:1000/mode:33188/mtime:1560587400/uid:1000"}, archived, archived},
+		{"invalid", map[string]string{"mtime": "yesterday"}, lastModified, lastModified},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mtime, atime := originalTimes(&s3.HeadObjectOutput{LastModified: aws.Time(lastModified), Metadata: tt.metadata})
+			assert.True(t, tt.expectedMtime.Equal(mtime), "mtime %v", mtime)
+			assert.True(t, tt.expectedAtime.Equal(atime), "atime %v", atime)
+		})
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	mode, ok := parseMode("0640")
+	assert.True(t, ok)
+	assert.Equal(t, os.FileMode(0640), mode)
+
+	// s3cmd stores the decimal st_mode of a regular file
+	mode, ok = parseMode("33188")
+	assert.True(t, ok)
+	assert.Equal(t, os.FileMode(0644), mode)
+
+	// Only permission bits are restored
+	mode, ok = parseMode("04755")
+	assert.True(t, ok)
+	assert.Equal(t, os.FileMode(0755), mode)
+
+	_, ok = parseMode("rw-r--r--")
+	assert.False(t, ok)
+}
+
+func TestApplyMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "clip.mxf")
+	assert.NoError(t, os.WriteFile(path, []byte("data"), 0664))
+	assert.NoError(t, os.Chmod(path, 0664))
+	archived := time.Date(2019, 6, 15, 8, 30, 0, 0, time.UTC)
+	head := &s3.HeadObjectOutput{
+		LastModified: aws.Time(time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)),
+		Metadata:     map[string]string{"mtime": "1560587400", "mode": "0640"},
+	}
+
+	assert.NoError(t, applyMetadata(path, head, false))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.True(t, archived.Equal(info.ModTime()))
+	assert.Equal(t, os.FileMode(0664), info.Mode().Perm())
+
+	assert.NoError(t, applyMetadata(path, head, true))
+	info, err = os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	// Restored files are recognised as identical by their original time
+	head.ContentLength = aws.Int64(4)
+	assert.True(t, isIdentical(path, info, head))
+}
@@ -2,61 +2,209 @@ package s3utils
 
 import (
 	"bufio"
+	"compress/gzip"
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"math/rand"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"golang.org/x/time/rate"
 )
 
-func MonitorObjectRestoreStatus(ctx context.Context, client *s3.Client) ([]S3Entry, error) {
-	keys, err := readManifestFile("/tmp/manifest.csv")
-	if err != nil {
-		return nil, fmt.Errorf("failed to read manifest file: %v", err)
+// ProgressFunc is called with the number of items processed so far out of the total.
+type ProgressFunc func(done, total int)
+
+const (
+	defaultPollWorkers    = 16
+	defaultHeadObjectRate = 100
+)
+
+// MonitorOptions controls how hard the restore status of objects is polled.
+// Zero values fall back to the defaults.
+type MonitorOptions struct {
+	Workers        int           // concurrent HeadObject calls
+	HeadObjectRate int           // HeadObject calls per second
+	PollInterval   time.Duration // average time between passes
+}
+
+// DefaultPollInterval returns the time between restore status passes for a
+// retrieval tier. Faster tiers are polled more often.
+func DefaultPollInterval(retrievalType string) time.Duration {
+	switch retrievalType {
+	case "Expedited":
+		return time.Minute
+	case "Standard":
+		return 10 * time.Minute
+	default:
+		return 30 * time.Minute
 	}
-	// Remove keys that are directories and have the "/" suffix
-	keys = removeDirectories(keys)
+}
+
+func (o MonitorOptions) withDefaults() MonitorOptions {
+	if o.Workers <= 0 {
+		o.Workers = defaultPollWorkers
+	}
+	if o.HeadObjectRate <= 0 {
+		o.HeadObjectRate = defaultHeadObjectRate
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = DefaultPollInterval("")
+	}
+	return o
+}
 
-	log.Printf("Monitoring %d objects", len(keys))
+// nextPollInterval spreads passes between half and one and a half times the
+// poll interval so that concurrent workers don't poll in lockstep.
+func (o MonitorOptions) nextPollInterval() time.Duration {
+	return o.PollInterval/2 + time.Duration(rand.Int63n(int64(o.PollInterval)))
+}
+
+// MonitorObjectRestoreStatus polls keys until they are restored and sends each
+// one on restored as soon as it becomes available. restored is closed when
+// every key has been sent or monitoring stops.
+func MonitorObjectRestoreStatus(ctx context.Context, client S3ClientInterface, keys []S3Entry, opts MonitorOptions, restored chan<- S3Entry, onProgress ProgressFunc) error {
+	defer close(restored)
+
+	opts = opts.withDefaults()
+	limiter := rate.NewLimiter(rate.Limit(opts.HeadObjectRate), opts.Workers)
+
+	log.Printf("Monitoring %d objects with %d workers at up to %d requests/s", len(keys), opts.Workers, opts.HeadObjectRate)
 	remainingKeys := keys
 	for len(remainingKeys) > 0 {
-		var stillRestoring []S3Entry
-		for _, key := range remainingKeys {
-			restored, err := checkRestoreStatus(ctx, client, key.Bucket, key.Key)
-			if err != nil {
-				log.Printf("Error checking restore status for %s/%s: %v", key.Bucket, key.Key, err)
-				stillRestoring = append(stillRestoring, key)
-				continue
-			}
-			if !restored {
-				stillRestoring = append(stillRestoring, key)
-			} else {
-				log.Printf("Object %s/%s has been restored", key.Bucket, key.Key)
+		stillRestoring, err := pollRestoreStatus(ctx, client, remainingKeys, opts.Workers, limiter, func(entry S3Entry) {
+			select {
+			case restored <- entry:
+			case <-ctx.Done():
 			}
+		})
+		if err != nil {
+			return err
+		}
+
+		if onProgress != nil {
+			onProgress(len(keys)-len(stillRestoring), len(keys))
 		}
 
 		if len(stillRestoring) == 0 {
 			log.Println("All objects restored successfully")
-			return keys, nil
+			return nil
 		}
 
 		remainingKeys = stillRestoring
-		sleepDuration := time.Duration(15+rand.Intn(30)) * time.Minute
+		sleepDuration := opts.nextPollInterval()
 		log.Printf("%d objects still restoring. Waiting %v before next check...", len(remainingKeys), sleepDuration)
-		log.Printf("Remaining keys: %v", remainingKeys)
-		time.Sleep(sleepDuration)
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping restore monitor")
+			return ctx.Err()
+		case <-time.After(sleepDuration):
+		}
+	}
+	return nil
+}
+
+// PollingMonitor is a RestoreMonitor that polls HeadObject for every key.
+type PollingMonitor struct {
+	client S3ClientInterface
+	opts   MonitorOptions
+}
+
+func NewPollingMonitor(client S3ClientInterface, opts MonitorOptions) *PollingMonitor {
+	return &PollingMonitor{client: client, opts: opts}
+}
+
+func (m *PollingMonitor) Monitor(ctx context.Context, keys []S3Entry, restored chan<- S3Entry, onProgress ProgressFunc) error {
+	return MonitorObjectRestoreStatus(ctx, m.client, keys, m.opts, restored, onProgress)
+}
+
+type restoreStatus struct {
+	entry    S3Entry
+	restored bool
+	err      error
+}
+
+// pollRestoreStatus checks every key once using a pool of workers, calling
+// onRestored for the restored ones and returning those that are still restoring.
+func pollRestoreStatus(ctx context.Context, client S3ClientInterface, keys []S3Entry, workers int, limiter *rate.Limiter, onRestored func(S3Entry)) ([]S3Entry, error) {
+	jobs := make(chan S3Entry)
+	results := make(chan restoreStatus)
+
+	go func() {
+		defer close(jobs)
+		for _, key := range keys {
+			select {
+			case jobs <- key:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range jobs {
+				if err := limiter.Wait(ctx); err != nil {
+					results <- restoreStatus{entry: key, err: err}
+					continue
+				}
+				isRestored, err := checkRestoreStatus(ctx, client, key.Bucket, key.Key)
+				results <- restoreStatus{entry: key, restored: isRestored, err: err}
+			}
+		}()
 	}
-	return nil, nil
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	var stillRestoring []S3Entry
+	for result := range results {
+		if ctx.Err() != nil {
+			// Keep draining so the workers can exit
+			continue
+		}
+		if result.err != nil {
+			log.Printf("Error checking restore status for %s/%s: %v", result.entry.Bucket, result.entry.Key, result.err)
+			stillRestoring = append(stillRestoring, result.entry)
+			continue
+		}
+		if !result.restored {
+			stillRestoring = append(stillRestoring, result.entry)
+			continue
+		}
+		log.Printf("Object %s/%s has been restored", result.entry.Bucket, result.entry.Key)
+		onRestored(result.entry)
+	}
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return stillRestoring, nil
 }
 
 type S3Entry struct {
-	Bucket string
-	Key    string
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+// LoadManifest reads the entries of a local manifest, skipping directory markers.
+func LoadManifest(manifestPath string) ([]S3Entry, error) {
+	keys, err := readManifestFile(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest file: %v", err)
+	}
+	// Remove keys that are directories and have the "/" suffix
+	return removeDirectories(keys), nil
 }
 
 func removeDirectories(keys []S3Entry) []S3Entry {
@@ -77,8 +225,20 @@ func readManifestFile(filepath string) ([]S3Entry, error) {
 	}
 	defer file.Close()
 
+	// Manifests may be gzipped, which is detected from their header
+	reader := bufio.NewReader(file)
+	var input io.Reader = reader
+	if header, err := reader.Peek(2); err == nil && header[0] == 0x1f && header[1] == 0x8b {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		defer gz.Close()
+		input = gz
+	}
+
 	var entries []S3Entry
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(input)
 	for scanner.Scan() {
 		parts := strings.Split(scanner.Text(), ",")
 		if len(parts) == 2 {
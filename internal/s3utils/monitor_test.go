@@ -1,9 +1,12 @@
 package s3utils
 
 import (
+	"compress/gzip"
 	"context"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
@@ -102,3 +105,100 @@ bucket3,key3`
 	assert.Equal(t, S3Entry{Bucket: "bucket2", Key: "key2"}, entries[1])
 	assert.Equal(t, S3Entry{Bucket: "bucket3", Key: "key3"}, entries[2])
 }
+
+func TestReadGzippedManifestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest_available.csv.gz")
+	file, err := os.Create(path)
+	assert.NoError(t, err)
+	gz := gzip.NewWriter(file)
+	_, err = gz.Write([]byte("bucket1,key1\nbucket2,key2\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, gz.Close())
+	assert.NoError(t, file.Close())
+
+	entries, err := readManifestFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []S3Entry{{Bucket: "bucket1", Key: "key1"}, {Bucket: "bucket2", Key: "key2"}}, entries)
+}
+
+func TestMonitorObjectRestoreStatusEmitsRestoredKeys(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockS3Client := NewMockS3ClientInterface(mockCtrl)
+	mockS3Client.EXPECT().
+		HeadObject(gomock.Any(), &s3.HeadObjectInput{Bucket: aws.String("bucket1"), Key: aws.String("a.mov")}, gomock.Any()).
+		Return(&s3.HeadObjectOutput{
+			StorageClass: types.StorageClassDeepArchive,
+			Restore:      aws.String(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`),
+		}, nil)
+	mockS3Client.EXPECT().
+		HeadObject(gomock.Any(), &s3.HeadObjectInput{Bucket: aws.String("bucket1"), Key: aws.String("b.mov")}, gomock.Any()).
+		Return(&s3.HeadObjectOutput{
+			StorageClass: types.StorageClassGlacier,
+			Restore:      aws.String(`ongoing-request="false"`),
+		}, nil)
+
+	keys := []S3Entry{{Bucket: "bucket1", Key: "a.mov"}, {Bucket: "bucket1", Key: "b.mov"}}
+	restored := make(chan S3Entry)
+	monitorErr := make(chan error, 1)
+	var progress []int
+	go func() {
+		monitorErr <- MonitorObjectRestoreStatus(context.Background(), mockS3Client, keys, MonitorOptions{Workers: 2}, restored, func(done, total int) {
+			progress = append(progress, done)
+		})
+	}()
+
+	// Keys are received as they are restored and the channel is closed afterwards
+	var received []S3Entry
+	for entry := range restored {
+		received = append(received, entry)
+	}
+	assert.NoError(t, <-monitorErr)
+	assert.ElementsMatch(t, keys, received)
+	assert.Equal(t, []int{2}, progress)
+}
+
+func TestMonitorObjectRestoreStatusStopsWhenCancelled(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	restored := make(chan S3Entry)
+	err := MonitorObjectRestoreStatus(ctx, NewMockS3ClientInterface(mockCtrl), []S3Entry{{Bucket: "bucket1", Key: "a.mov"}}, MonitorOptions{}, restored, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, open := <-restored
+	assert.False(t, open)
+}
+
+func TestMonitorObjectRestoreStatusPollsUntilRestored(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockS3Client := NewMockS3ClientInterface(mockCtrl)
+	gomock.InOrder(
+		mockS3Client.EXPECT().HeadObject(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&s3.HeadObjectOutput{StorageClass: types.StorageClassGlacier, Restore: aws.String(`ongoing-request="true"`)}, nil),
+		mockS3Client.EXPECT().HeadObject(gomock.Any(), gomock.Any(), gomock.Any()).
+			Return(&s3.HeadObjectOutput{StorageClass: types.StorageClassGlacier, Restore: aws.String(`ongoing-request="false"`)}, nil),
+	)
+
+	restored := make(chan S3Entry, 1)
+	var progress []int
+	opts := MonitorOptions{Workers: 1, HeadObjectRate: 10, PollInterval: 10 * time.Millisecond}
+	err := MonitorObjectRestoreStatus(context.Background(), mockS3Client, []S3Entry{{Bucket: "bucket1", Key: "a.mov"}}, opts, restored, func(done, total int) {
+		progress = append(progress, done)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, S3Entry{Bucket: "bucket1", Key: "a.mov"}, <-restored)
+	assert.Equal(t, []int{0, 1}, progress)
+}
+
+func TestDefaultPollInterval(t *testing.T) {
+	assert.Equal(t, time.Minute, DefaultPollInterval("Expedited"))
+	assert.Equal(t, 10*time.Minute, DefaultPollInterval("Standard"))
+	assert.Equal(t, 30*time.Minute, DefaultPollInterval("Bulk"))
+}
@@ -0,0 +1,149 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// File statuses in a Report.
+const (
+	StatusSucceeded = "succeeded"
+	StatusSkipped   = "skipped"
+	StatusFailed    = "failed"
+)
+
+// Report summarises the outcome of every file handled by a restore worker.
+type Report struct {
+	RestoreID  string    `json:"restoreId"`
+	ProjectId  int       `json:"projectId"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Succeeded  int       `json:"succeeded"`
+	Skipped    int       `json:"skipped"`
+	Failed     int       `json:"failed"`
+	Rejected   int       `json:"rejected"` // failed files with unsafe keys
+	Bytes      int64     `json:"bytes"`
+	// Files downloaded by a previous worker for the same restore
+	PreviouslyDownloaded int          `json:"previouslyDownloaded"`
+	Files                []FileResult `json:"files"`
+}
+
+// Status returns how a file is counted in a report.
+func (r FileResult) Status() string {
+	switch {
+	case r.Err != nil:
+		return StatusFailed
+	case r.Action == ActionSkipped:
+		return StatusSkipped
+	default:
+		return StatusSucceeded
+	}
+}
+
+func NewReport(restoreID string, projectID int, startedAt time.Time, results []FileResult) *Report {
+	report := &Report{
+		RestoreID:  restoreID,
+		ProjectId:  projectID,
+		StartedAt:  startedAt,
+		FinishedAt: time.Now(),
+		Files:      make([]FileResult, 0, len(results)),
+	}
+	for _, result := range results {
+		switch result.Status() {
+		case StatusFailed:
+			report.Failed++
+			if result.Action == ActionRejected {
+				report.Rejected++
+			}
+			result.Error = result.Err.Error()
+		case StatusSkipped:
+			report.Skipped++
+		default:
+			report.Succeeded++
+			report.Bytes += result.Size
+		}
+		report.Files = append(report.Files, result)
+	}
+	return report
+}
+
+// FailedFiles returns the results of the files that failed.
+func (r *Report) FailedFiles() []FileResult {
+	var failed []FileResult
+	for _, file := range r.Files {
+		if file.Status() == StatusFailed {
+			failed = append(failed, file)
+		}
+	}
+	return failed
+}
+
+func (r *Report) WriteCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"bucket", "key", "status", "action", "path", "bytes", "duration_ms", "retries", "verification", "quarantine_path", "error"})
+	for _, file := range r.Files {
+		writer.Write([]string{
+			file.Bucket,
+			file.Key,
+			file.Status(),
+			file.Action,
+			file.Path,
+			strconv.FormatInt(file.Size, 10),
+			strconv.FormatInt(file.DurationMs, 10),
+			strconv.Itoa(file.Retries),
+			file.Verification,
+			file.QuarantinePath,
+			file.Error,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// ReportKey returns the key of a report stored alongside a manifest, where ext
+// is "json" or "csv".
+func ReportKey(manifestKey, ext string) string {
+	return strings.TrimSuffix(manifestKey, ".csv") + ".report." + ext
+}
+
+// UploadReport stores the report as JSON and CSV next to the manifest.
+func UploadReport(ctx context.Context, client S3ObjectClient, bucket, manifestKey string, report *Report) error {
+	jsonData, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	var csvData bytes.Buffer
+	if err := report.WriteCSV(&csvData); err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	for _, upload := range []struct {
+		key         string
+		data        []byte
+		contentType string
+	}{
+		{ReportKey(manifestKey, "json"), jsonData, "application/json"},
+		{ReportKey(manifestKey, "csv"), csvData.Bytes(), "text/csv"},
+	} {
+		_, err := client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(bucket),
+			Key:         aws.String(upload.key),
+			Body:        bytes.NewReader(upload.data),
+			ContentType: aws.String(upload.contentType),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to upload report s3://%s/%s: %w", bucket, upload.key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package s3utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	results := []FileResult{
+		{S3Entry: S3Entry{Bucket: "bucket1", Key: "a.mov"}, Action: ActionDownloaded, Size: 100, Verification: VerifiedSHA256},
+		{S3Entry: S3Entry{Bucket: "bucket1", Key: "b.mov"}, Action: ActionSkipped},
+		{S3Entry: S3Entry{Bucket: "bucket1", Key: "c.mov"}, Err: errors.New("sha256 mismatch"), QuarantinePath: "/quarantine/c.mov"},
+		{S3Entry: S3Entry{Bucket: "bucket1", Key: "d.mov"}, Action: ActionKeptBoth, Size: 50},
+		{S3Entry: S3Entry{Bucket: "bucket1", Key: "../e.mov"}, Action: ActionRejected, Err: ErrUnsafeKey},
+	}
+
+	report := NewReport("restore-1", 1234, time.Now(), results)
+	assert.Equal(t, 2, report.Succeeded)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 2, report.Failed)
+	assert.Equal(t, 1, report.Rejected)
+	assert.Equal(t, int64(150), report.Bytes)
+	assert.Len(t, report.FailedFiles(), 2)
+	assert.Equal(t, "sha256 mismatch", report.FailedFiles()[0].Error)
+
+	var csvData strings.Builder
+	assert.NoError(t, report.WriteCSV(&csvData))
+	lines := strings.Split(strings.TrimSpace(csvData.String()), "\n")
+	assert.Len(t, lines, 6)
+	assert.Equal(t, "bucket1,c.mov,failed,,,0,0,0,,/quarantine/c.mov,sha256 mismatch", lines[3])
+}
+
+func TestUploadReport(t *testing.T) {
+	store := &fakeObjectStore{objects: map[string][]byte{}}
+	manifestKey := "batch-manifests/1234_test_user_2024-01-01_00-00-00.csv"
+	report := NewReport("restore-1", 1234, time.Now(), []FileResult{
+		{S3Entry: S3Entry{Bucket: "bucket1", Key: "a.mov"}, Action: ActionDownloaded, Size: 100},
+	})
+
+	assert.NoError(t, UploadReport(context.Background(), store, "manifest-bucket", manifestKey, report))
+	assert.Contains(t, store.objects, "manifest-bucket/batch-manifests/1234_test_user_2024-01-01_00-00-00.report.csv")
+
+	var uploaded Report
+	assert.NoError(t, json.Unmarshal(store.objects["manifest-bucket/batch-manifests/1234_test_user_2024-01-01_00-00-00.report.json"], &uploaded))
+	assert.Equal(t, 1, uploaded.Succeeded)
+	assert.Equal(t, "a.mov", uploaded.Files[0].Key)
+}
@@ -0,0 +1,237 @@
+package s3utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const (
+	// Objects at least this large are downloaded in segments that survive a
+	// failed attempt or a worker restart
+	resumableDownloadSize = 1 << 30
+
+	resumeStateSuffix = ".state"
+	// How long an abandoned resumable download is kept before it is cleaned up
+	resumablePartialMaxAge = 7 * 24 * time.Hour
+)
+
+// resumeSegmentSize is the size of each ranged GET of a resumable download, and
+// so the most that is lost when a download is interrupted.
+var resumeSegmentSize int64 = 256 << 20
+
+// resumeState is stored next to a partial download and records how much of
+// which version of the object is safely on disk.
+type resumeState struct {
+	Bucket          string `json:"bucket"`
+	Key             string `json:"key"`
+	ETag            string `json:"etag"`
+	Size            int64  `json:"size"`
+	CompletedOffset int64  `json:"completedOffset"`
+}
+
+// resumableTempPath is the fixed temporary path of a resumable download, so that
+// a later attempt can find it.
+func resumableTempPath(finalPath string) string {
+	return filepath.Join(filepath.Dir(finalPath), "."+filepath.Base(finalPath)+".partial"+tempFileSuffix)
+}
+
+func loadResumeState(path string) *resumeState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state resumeState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Ignoring invalid resume state %s: %v", path, err)
+		return nil
+	}
+	return &state
+}
+
+func saveResumeState(path string, state *resumeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0664)
+}
+
+// removePartialDownload removes a resumable download's data and state.
+func removePartialDownload(tempPath string) {
+	os.Remove(tempPath)
+	os.Remove(tempPath + resumeStateSuffix)
+}
+
+// RemovePartialDownloads removes the partial downloads and resume state kept for
+// entries, which are only worth keeping when the restore will be resumed. It
+// returns how many partial downloads were removed.
+func RemovePartialDownloads(entries []S3Entry, opts DownloadOptions) int {
+	basePath := filepath.Clean(opts.BasePath)
+	removed := 0
+	for _, entry := range entries {
+		path, err := LocalPath(basePath, entry.Key, opts.KeyEscaping)
+		if err != nil {
+			continue
+		}
+		tempPath := resumableTempPath(path)
+		_, dataErr := os.Lstat(tempPath)
+		_, stateErr := os.Lstat(tempPath + resumeStateSuffix)
+		if dataErr != nil && stateErr != nil {
+			continue
+		}
+		removePartialDownload(tempPath)
+		log.Printf("Removed partial download %s", tempPath)
+		removed++
+	}
+	return removed
+}
+
+// offsetWriterAt shifts writes by offset, as the downloader writes a ranged
+// download from position zero.
+type offsetWriterAt struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o offsetWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	return o.w.WriteAt(p, o.offset+off)
+}
+
+// downloadResumable downloads an object to tempPath in ranged segments,
+// continuing from the completed offset of an earlier attempt when the object
+// has not changed since. Segments are downloaded opts.PartConcurrency at a time.
+// The completed offset only advances once every segment before it is synced to
+// disk.
+func downloadResumable(ctx context.Context, client manager.DownloadAPIClient, entry S3Entry, head *s3.HeadObjectOutput, tempPath string, opts DownloadOptions) (int64, error) {
+	size := aws.ToInt64(head.ContentLength)
+	etag := aws.ToString(head.ETag)
+	statePath := tempPath + resumeStateSuffix
+
+	state := loadResumeState(statePath)
+	if state != nil && state.ETag == etag && state.Size == size {
+		log.Printf("Resuming download of %s/%s at %d of %d bytes", entry.Bucket, entry.Key, state.CompletedOffset, size)
+	} else {
+		removePartialDownload(tempPath)
+		state = &resumeState{Bucket: entry.Bucket, Key: entry.Key, ETag: etag, Size: size}
+	}
+
+	file, err := os.OpenFile(tempPath, os.O_CREATE|os.O_RDWR, 0664)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open %s: %w", tempPath, err)
+	}
+	defer file.Close()
+	// Create file with correct permissions (0664 = rw-rw-r--)
+	if err := file.Chmod(0664); err != nil {
+		return 0, fmt.Errorf("failed to set permissions on %s: %w", tempPath, err)
+	}
+	if err := saveResumeState(statePath, state); err != nil {
+		return 0, fmt.Errorf("failed to save resume state %s: %w", statePath, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var segments []int64
+	for start := state.CompletedOffset; start < size; start += resumeSegmentSize {
+		segments = append(segments, start)
+	}
+	jobs := make(chan int64, len(segments))
+	for _, start := range segments {
+		jobs <- start
+	}
+	close(jobs)
+
+	// Each segment is a single ranged GET, so the segments provide the concurrency
+	downloader := manager.NewDownloader(client)
+	var (
+		mu       sync.Mutex
+		done     = make(map[int64]bool)
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for w := 0; w < opts.PartConcurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				end := min(start+resumeSegmentSize, size) - 1
+				_, err := downloader.Download(ctx, throttle(ctx, offsetWriterAt{w: file, offset: start}, opts.Limiter), &s3.GetObjectInput{
+					Bucket:  aws.String(entry.Bucket),
+					Key:     aws.String(entry.Key),
+					Range:   aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+					IfMatch: head.ETag,
+				})
+				if err == nil {
+					err = recordSegment(file, statePath, state, &mu, done, start)
+				}
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					cancel()
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return state.CompletedOffset, fmt.Errorf("failed to download file %s/%s: %w", entry.Bucket, entry.Key, firstErr)
+	}
+	if ctx.Err() != nil {
+		return state.CompletedOffset, ctx.Err()
+	}
+	if err := file.Close(); err != nil {
+		return size, fmt.Errorf("failed to close file %s: %w", tempPath, err)
+	}
+	return size, nil
+}
+
+// recordSegment marks the segment starting at start as complete and advances
+// the persisted offset past every contiguous completed segment.
+func recordSegment(file *os.File, statePath string, state *resumeState, mu *sync.Mutex, done map[int64]bool, start int64) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	done[start] = true
+	advanced := false
+	for done[state.CompletedOffset] {
+		delete(done, state.CompletedOffset)
+		state.CompletedOffset = min(state.CompletedOffset+resumeSegmentSize, state.Size)
+		advanced = true
+	}
+	if !advanced {
+		return nil
+	}
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync %s: %w", file.Name(), err)
+	}
+	if err := saveResumeState(statePath, state); err != nil {
+		return fmt.Errorf("failed to save resume state %s: %w", statePath, err)
+	}
+	return nil
+}
+
+// keepPartialDownload reports whether a failed resumable download is worth
+// keeping for the next attempt.
+func keepPartialDownload(err error) bool {
+	return isRetryable(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
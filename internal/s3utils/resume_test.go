@@ -0,0 +1,165 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+)
+
+// rangeObjectStore serves ranged GETs of a single object and can fail the
+// request for one range.
+type rangeObjectStore struct {
+	data      []byte
+	failStart int64
+	mu        sync.Mutex
+	starts    []int64
+}
+
+func (f *rangeObjectStore) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	var start, end int64
+	if _, err := fmt.Sscanf(aws.ToString(params.Range), "bytes=%d-%d", &start, &end); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.starts = append(f.starts, start)
+	fail := start == f.failStart
+	f.mu.Unlock()
+	if fail {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(bytes.NewReader(f.data[start : end+1])),
+		ContentLength: aws.Int64(end - start + 1),
+		ContentRange:  aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, len(f.data))),
+	}, nil
+}
+
+func withSegmentSize(t *testing.T, size int64) {
+	previous := resumeSegmentSize
+	resumeSegmentSize = size
+	t.Cleanup(func() { resumeSegmentSize = previous })
+}
+
+func TestDownloadResumable(t *testing.T) {
+	withSegmentSize(t, 10)
+	data := []byte("0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHI")
+	store := &rangeObjectStore{data: data, failStart: 20}
+	entry := S3Entry{Bucket: "bucket1", Key: "clip.mxf"}
+	head := &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(data))), ETag: aws.String(`"abc"`)}
+	tempPath := resumableTempPath(filepath.Join(t.TempDir(), "clip.mxf"))
+
+	_, err := downloadResumable(context.Background(), store, entry, head, tempPath, DownloadOptions{}.withDefaults())
+	assert.Error(t, err)
+	assert.True(t, keepPartialDownload(err))
+	state := loadResumeState(tempPath + resumeStateSuffix)
+	assert.NotNil(t, state)
+	assert.LessOrEqual(t, state.CompletedOffset, int64(20))
+
+	// The next attempt only fetches what wasn't completed
+	store.failStart = -1
+	store.starts = nil
+	n, err := downloadResumable(context.Background(), store, entry, head, tempPath, DownloadOptions{}.withDefaults())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(data)), n)
+	for _, start := range store.starts {
+		assert.GreaterOrEqual(t, start, state.CompletedOffset)
+	}
+	written, err := os.ReadFile(tempPath)
+	assert.NoError(t, err)
+	assert.Equal(t, data, written)
+}
+
+func TestDownloadResumableRestartsChangedObject(t *testing.T) {
+	withSegmentSize(t, 10)
+	data := []byte("0123456789abcdefghij")
+	store := &rangeObjectStore{data: data, failStart: -1}
+	entry := S3Entry{Bucket: "bucket1", Key: "clip.mxf"}
+	head := &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(data))), ETag: aws.String(`"new"`)}
+	tempPath := resumableTempPath(filepath.Join(t.TempDir(), "clip.mxf"))
+
+	// A partial download of an older version of the object
+	assert.NoError(t, os.WriteFile(tempPath, []byte("XXXXXXXXXXXXXXXXXXXXXXXXX"), 0664))
+	assert.NoError(t, saveResumeState(tempPath+resumeStateSuffix, &resumeState{ETag: `"old"`, Size: 25, CompletedOffset: 10}))
+
+	_, err := downloadResumable(context.Background(), store, entry, head, tempPath, DownloadOptions{}.withDefaults())
+	assert.NoError(t, err)
+	assert.Contains(t, store.starts, int64(0))
+	written, err := os.ReadFile(tempPath)
+	assert.NoError(t, err)
+	assert.Equal(t, data, written)
+}
+
+func TestRecordSegment(t *testing.T) {
+	withSegmentSize(t, 10)
+	file, err := os.Create(filepath.Join(t.TempDir(), "partial"))
+	assert.NoError(t, err)
+	defer file.Close()
+	statePath := file.Name() + resumeStateSuffix
+	state := &resumeState{Size: 35}
+	var mu sync.Mutex
+	done := make(map[int64]bool)
+
+	// Segments finishing out of order don't move the offset past a gap
+	assert.NoError(t, recordSegment(file, statePath, state, &mu, done, 10))
+	assert.Zero(t, state.CompletedOffset)
+	assert.NoError(t, recordSegment(file, statePath, state, &mu, done, 0))
+	assert.Equal(t, int64(20), state.CompletedOffset)
+	assert.NoError(t, recordSegment(file, statePath, state, &mu, done, 30))
+	assert.NoError(t, recordSegment(file, statePath, state, &mu, done, 20))
+	assert.Equal(t, int64(35), state.CompletedOffset)
+	assert.Equal(t, int64(35), loadResumeState(statePath).CompletedOffset)
+}
+
+func TestCleanupTempFilesKeepsResumablePartials(t *testing.T) {
+	basePath := t.TempDir()
+	partial := resumableTempPath(filepath.Join(basePath, "clip.mxf"))
+	abandoned := resumableTempPath(filepath.Join(basePath, "other.mxf"))
+	orphanState := resumableTempPath(filepath.Join(basePath, "gone.mxf")) + resumeStateSuffix
+	for _, path := range []string{partial, partial + resumeStateSuffix, abandoned, abandoned + resumeStateSuffix, orphanState} {
+		assert.NoError(t, os.WriteFile(path, []byte("{}"), 0664))
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	assert.NoError(t, os.Chtimes(partial, old, old))
+	older := time.Now().Add(-2 * resumablePartialMaxAge)
+	assert.NoError(t, os.Chtimes(abandoned, older, older))
+
+	removed, err := CleanupTempFiles(basePath, time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.FileExists(t, partial)
+	assert.FileExists(t, partial+resumeStateSuffix)
+	assert.NoFileExists(t, abandoned)
+	assert.NoFileExists(t, abandoned+resumeStateSuffix)
+	assert.NoFileExists(t, orphanState)
+}
+
+func TestRemovePartialDownloads(t *testing.T) {
+	basePath := t.TempDir()
+	partial := resumableTempPath(filepath.Join(basePath, "Project", "clip.mxf"))
+	other := resumableTempPath(filepath.Join(basePath, "Other", "clip.mxf"))
+	for _, path := range []string{partial, partial + resumeStateSuffix, other, other + resumeStateSuffix} {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte("{}"), 0664))
+	}
+
+	// Only the partials of the given entries are removed
+	removed := RemovePartialDownloads([]S3Entry{
+		{Bucket: "bucket1", Key: "Project/clip.mxf"},
+		{Bucket: "bucket1", Key: "Project/small.mov"},
+	}, DownloadOptions{BasePath: basePath})
+	assert.Equal(t, 1, removed)
+	assert.NoFileExists(t, partial)
+	assert.NoFileExists(t, partial+resumeStateSuffix)
+	assert.FileExists(t, other)
+	assert.FileExists(t, other+resumeStateSuffix)
+}
@@ -0,0 +1,81 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	"github.com/cenkalti/backoff/v4"
+)
+
+const (
+	maxDownloadRetries      = 5
+	maxDownloadRetryBackoff = 2 * time.Minute
+)
+
+// downloadRetryInterval is the wait before the first retry, doubling after that.
+var downloadRetryInterval = time.Second
+
+// terminalErrorCodes are S3 errors that retrying will not fix.
+var terminalErrorCodes = map[string]bool{
+	"AccessDenied":          true,
+	"InvalidObjectState":    true,
+	"NoSuchKey":             true,
+	"NoSuchBucket":          true,
+	"NotFound":              true,
+	"InvalidAccessKeyId":    true,
+	"SignatureDoesNotMatch": true,
+	"AllAccessDisabled":     true,
+}
+
+// isRetryable reports whether a download failure is transient, such as
+// throttling, a 5xx response or a dropped connection. Anything else, including
+// local filesystem errors and failed verification, is terminal.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && terminalErrorCodes[apiErr.ErrorCode()] {
+		return false
+	}
+	// The connection dropped while the body was being read
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// withRetries runs download until it succeeds, fails with a terminal error or
+// runs out of retries, and returns the last result with its retry count.
+func withRetries(ctx context.Context, download func() FileResult) FileResult {
+	policy := backoff.NewExponentialBackOff()
+	policy.InitialInterval = downloadRetryInterval
+	policy.MaxInterval = maxDownloadRetryBackoff
+	policy.MaxElapsedTime = 0
+
+	var result FileResult
+	attempts := 0
+	operation := func() error {
+		attempts++
+		result = download()
+		if result.Err != nil && !isRetryable(result.Err) {
+			return backoff.Permanent(result.Err)
+		}
+		return result.Err
+	}
+	notify := func(err error, wait time.Duration) {
+		log.Printf("Retrying %s/%s in %v after error: %v", result.Bucket, result.Key, wait.Round(time.Second), err)
+	}
+
+	backoff.RetryNotify(operation, backoff.WithContext(backoff.WithMaxRetries(policy, maxDownloadRetries), ctx), notify)
+	result.Retries = attempts - 1
+	return result
+}
@@ -0,0 +1,82 @@
+package s3utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func responseError(statusCode int) error {
+	return &smithyhttp.ResponseError{
+		Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+		Err:      errors.New("response error"),
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		name      string
+		err       error
+		retryable bool
+	}{
+		{"Throttled", &smithy.GenericAPIError{Code: "SlowDown"}, true},
+		{"Service unavailable", responseError(http.StatusServiceUnavailable), true},
+		{"Connection reset", fmt.Errorf("failed to download file: %w", syscall.ECONNRESET), true},
+		{"Truncated body", fmt.Errorf("failed to download file: %w", io.ErrUnexpectedEOF), true},
+		{"Access denied", fmt.Errorf("failed to download file: %w", &smithy.GenericAPIError{Code: "AccessDenied"}), false},
+		{"Object still archived", &smithy.GenericAPIError{Code: "InvalidObjectState"}, false},
+		{"Forbidden", responseError(http.StatusForbidden), false},
+		{"Cancelled", fmt.Errorf("failed to download file: %w", context.Canceled), false},
+		{"Verification failed", errors.New("sha256 mismatch"), false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.retryable, isRetryable(tc.err))
+		})
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	downloadRetryInterval = time.Millisecond
+	defer func() { downloadRetryInterval = time.Second }()
+	entry := S3Entry{Bucket: "bucket1", Key: "a.mov"}
+
+	t.Run("Transient errors are retried", func(t *testing.T) {
+		attempts := 0
+		result := withRetries(context.Background(), func() FileResult {
+			attempts++
+			if attempts < 3 {
+				return FileResult{S3Entry: entry, Err: &smithy.GenericAPIError{Code: "SlowDown"}}
+			}
+			return FileResult{S3Entry: entry, Action: ActionDownloaded}
+		})
+		assert.NoError(t, result.Err)
+		assert.Equal(t, 2, result.Retries)
+	})
+
+	t.Run("Terminal errors are not retried", func(t *testing.T) {
+		result := withRetries(context.Background(), func() FileResult {
+			return FileResult{S3Entry: entry, Err: &smithy.GenericAPIError{Code: "AccessDenied"}}
+		})
+		assert.Error(t, result.Err)
+		assert.Equal(t, 0, result.Retries)
+	})
+
+	t.Run("Retries are limited", func(t *testing.T) {
+		result := withRetries(context.Background(), func() FileResult {
+			return FileResult{S3Entry: entry, Err: responseError(http.StatusInternalServerError)}
+		})
+		assert.Error(t, result.Err)
+		assert.Equal(t, maxDownloadRetries, result.Retries)
+	})
+}
@@ -0,0 +1,105 @@
+package s3utils
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// KeyEscaping is how characters that the SMB/NFS share can't store are handled
+// in object keys.
+type KeyEscaping string
+
+const (
+	KeyEscapingReplace KeyEscaping = "replace" // replaced with an underscore (default)
+	KeyEscapingPercent KeyEscaping = "percent" // percent-encoded, so names can be mapped back
+	KeyEscapingReject  KeyEscaping = "reject"  // the file is rejected
+)
+
+// Valid reports whether e is a known escaping strategy. The empty string is
+// accepted as the default.
+func (e KeyEscaping) Valid() bool {
+	switch e {
+	case "", KeyEscapingReplace, KeyEscapingPercent, KeyEscapingReject:
+		return true
+	}
+	return false
+}
+
+// ErrUnsafeKey is returned for keys that can't safely be written under the base
+// path, such as ones containing "..".
+var ErrUnsafeKey = errors.New("unsafe object key")
+
+const maxNameLength = 255
+
+// invalidNameChars can't be stored in file names on SMB shares.
+const invalidNameChars = `\:*?"<>|`
+
+// safeRelativePath turns an object key into a relative path that stays within
+// the base path and only contains characters the share can store, escaped as
+// escaping says. Keys that would escape the base path are always rejected.
+func safeRelativePath(key string, escaping KeyEscaping) (string, error) {
+	if strings.ContainsRune(key, 0) {
+		return "", fmt.Errorf("%w %q: contains a NUL character", ErrUnsafeKey, key)
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(key, "/") {
+		switch segment {
+		case "", ".":
+			// Leading, doubled and trailing slashes don't name anything
+			continue
+		case "..":
+			return "", fmt.Errorf("%w %q: contains a parent directory segment", ErrUnsafeKey, key)
+		}
+		escaped := escapeName(segment, escaping)
+		if escaped != segment && escaping == KeyEscapingReject {
+			return "", fmt.Errorf("%w %q: %q can't be stored on the share", ErrUnsafeKey, key, segment)
+		}
+		if len(escaped) > maxNameLength {
+			return "", fmt.Errorf("%w %q: name longer than %d bytes", ErrUnsafeKey, key, maxNameLength)
+		}
+		segments = append(segments, escaped)
+	}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("%w %q: no file name", ErrUnsafeKey, key)
+	}
+
+	// Escaping can't introduce separators or "..", but check the result anyway
+	rel := path.Join(segments...)
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("%w %q: escapes the base path", ErrUnsafeKey, key)
+	}
+	return rel, nil
+}
+
+// LocalPath returns where the object with the given key is restored to under
+// basePath.
+func LocalPath(basePath, key string, escaping KeyEscaping) (string, error) {
+	rel, err := safeRelativePath(key, escaping)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(basePath, rel), nil
+}
+
+// escapeName escapes control characters, characters the share can't store and
+// the trailing spaces and dots it strips from a single path segment.
+func escapeName(name string, escaping KeyEscaping) string {
+	keep := len(strings.TrimRight(name, " ."))
+	var b strings.Builder
+	for i, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(invalidNameChars, r) || i >= keep || (escaping == KeyEscapingPercent && r == '%') {
+			if escaping == KeyEscapingPercent {
+				fmt.Fprintf(&b, "%%%02X", r)
+			} else {
+				b.WriteByte('_')
+			}
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,51 @@
+package s3utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeRelativePath(t *testing.T) {
+	tests := []struct {
+		key      string
+		escaping KeyEscaping
+		expected string
+		rejected bool
+	}{
+		{"Project/Assets/clip.mxf", "", "Project/Assets/clip.mxf", false},
+		{"/Project//Assets/./clip.mxf", "", "Project/Assets/clip.mxf", false},
+		{"Project/../../etc/passwd", "", "", true},
+		{"..", "", "", true},
+		{"Project/", "", "Project", false},
+		{"/", "", "", true},
+		{"Project/a\x00b.mov", "", "", true},
+		{"Project/Scene 1: Intro.mov", "", "Project/Scene 1_ Intro.mov", false},
+		{"Project/Scene 1: Intro.mov", KeyEscapingPercent, "Project/Scene 1%3A Intro.mov", false},
+		{"Project/Scene 1: Intro.mov", KeyEscapingReject, "", true},
+		{"Project/Rushes /take\t1.mov", KeyEscapingReplace, "Project/Rushes_/take_1.mov", false},
+		{"Project/100%.mov", KeyEscapingPercent, "Project/100%25.mov", false},
+		{"Project/100%.mov", KeyEscapingReject, "Project/100%.mov", false},
+		{"Project/notes...", KeyEscapingPercent, "Project/notes%2E%2E%2E", false},
+		{`C:\Windows\clip.mov`, KeyEscapingReplace, "C__Windows_clip.mov", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			rel, err := safeRelativePath(tt.key, tt.escaping)
+			if tt.rejected {
+				assert.True(t, errors.Is(err, ErrUnsafeKey), "expected %q to be rejected, got %q", tt.key, rel)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, rel)
+		})
+	}
+}
+
+func TestKeyEscapingValid(t *testing.T) {
+	assert.True(t, KeyEscaping("").Valid())
+	assert.True(t, KeyEscapingPercent.Valid())
+	assert.False(t, KeyEscaping("strip").Valid())
+}
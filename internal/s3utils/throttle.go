@@ -0,0 +1,110 @@
+package s3utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ThrottleWindow is a daily time range, such as 09:00-19:00, during which
+// downloads are throttled. A window ending before it starts runs past midnight.
+type ThrottleWindow struct {
+	Start time.Duration // since midnight
+	End   time.Duration
+}
+
+// ParseThrottleWindow parses a window in the form "HH:MM-HH:MM".
+func ParseThrottleWindow(s string) (ThrottleWindow, error) {
+	start, end, ok := strings.Cut(s, "-")
+	if !ok {
+		return ThrottleWindow{}, fmt.Errorf("invalid throttle window %q, expected HH:MM-HH:MM", s)
+	}
+	var window ThrottleWindow
+	for _, part := range []struct {
+		value string
+		into  *time.Duration
+	}{{start, &window.Start}, {end, &window.End}} {
+		t, err := time.Parse("15:04", strings.TrimSpace(part.value))
+		if err != nil {
+			return ThrottleWindow{}, fmt.Errorf("invalid throttle window %q: %w", s, err)
+		}
+		*part.into = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+	return window, nil
+}
+
+// Contains reports whether t falls within the window, in t's time zone.
+func (w ThrottleWindow) Contains(t time.Time) bool {
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.Start <= w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// BandwidthLimiter limits the combined write rate of every download sharing it.
+// A nil BandwidthLimiter doesn't limit anything.
+type BandwidthLimiter struct {
+	limiter *rate.Limiter
+	window  *ThrottleWindow
+	now     func() time.Time
+}
+
+// NewBandwidthLimiter limits downloads to bytesPerSecond, only within window
+// if it is not nil. It returns nil if bytesPerSecond is not positive.
+func NewBandwidthLimiter(bytesPerSecond int64, window *ThrottleWindow) *BandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &BandwidthLimiter{
+		limiter: rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond)),
+		window:  window,
+		now:     time.Now,
+	}
+}
+
+// Throttled reports whether the limit currently applies.
+func (b *BandwidthLimiter) Throttled() bool {
+	return b != nil && (b.window == nil || b.window.Contains(b.now()))
+}
+
+// WaitN blocks until n bytes may be written.
+func (b *BandwidthLimiter) WaitN(ctx context.Context, n int) error {
+	if !b.Throttled() {
+		return nil
+	}
+	for n > 0 {
+		chunk := min(n, b.limiter.Burst())
+		if err := b.limiter.WaitN(ctx, chunk); err != nil {
+			return err
+		}
+		n -= chunk
+	}
+	return nil
+}
+
+// throttledWriterAt waits for the bandwidth limiter before each write.
+type throttledWriterAt struct {
+	ctx     context.Context
+	w       io.WriterAt
+	limiter *BandwidthLimiter
+}
+
+func (t throttledWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if err := t.limiter.WaitN(t.ctx, len(p)); err != nil {
+		return 0, err
+	}
+	return t.w.WriteAt(p, off)
+}
+
+// throttle wraps w with the limiter, if there is one.
+func throttle(ctx context.Context, w io.WriterAt, limiter *BandwidthLimiter) io.WriterAt {
+	if limiter == nil {
+		return w
+	}
+	return throttledWriterAt{ctx: ctx, w: w, limiter: limiter}
+}
@@ -0,0 +1,57 @@
+package s3utils
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottleWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC)
+	}
+
+	day, err := ParseThrottleWindow("09:00-19:00")
+	assert.NoError(t, err)
+	assert.True(t, day.Contains(at(9, 0)))
+	assert.True(t, day.Contains(at(18, 59)))
+	assert.False(t, day.Contains(at(19, 0)))
+	assert.False(t, day.Contains(at(3, 0)))
+
+	// Windows may run past midnight
+	night, err := ParseThrottleWindow("22:00 - 06:30")
+	assert.NoError(t, err)
+	assert.True(t, night.Contains(at(23, 0)))
+	assert.True(t, night.Contains(at(6, 0)))
+	assert.False(t, night.Contains(at(12, 0)))
+
+	for _, invalid := range []string{"", "09:00", "9am-5pm", "09:00-25:00"} {
+		_, err := ParseThrottleWindow(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestBandwidthLimiter(t *testing.T) {
+	assert.Nil(t, NewBandwidthLimiter(0, nil))
+	var unlimited *BandwidthLimiter
+	assert.False(t, unlimited.Throttled())
+	assert.NoError(t, unlimited.WaitN(context.Background(), 1<<30))
+
+	window, err := ParseThrottleWindow("09:00-19:00")
+	assert.NoError(t, err)
+	limiter := NewBandwidthLimiter(1000, &window)
+
+	limiter.now = func() time.Time { return time.Date(2024, 1, 1, 3, 0, 0, 0, time.UTC) }
+	assert.False(t, limiter.Throttled())
+	assert.NoError(t, limiter.WaitN(context.Background(), 1<<30))
+
+	// During the window writes beyond the burst have to wait for the limit
+	limiter.now = func() time.Time { return time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC) }
+	assert.True(t, limiter.Throttled())
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.NoError(t, limiter.WaitN(ctx, 1000))
+	assert.Error(t, limiter.WaitN(ctx, 1000))
+}
@@ -12,18 +12,26 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-func UploadFileToS3(ctx context.Context, s3Client S3ClientInterface, bucket, key, filePath string) (*s3.PutObjectOutput, error) {
-	log.Printf("Uploading file to S3: s3://%s/%s", bucket, key)
+// multipartUploadThreshold is the size above which files are uploaded in
+// parts. Smaller files are sent in a single request with a Content-MD5.
+var multipartUploadThreshold int64 = 64 << 20
 
+func UploadFileToS3(ctx context.Context, s3Client S3ClientInterface, bucket, key, filePath string) (*s3.PutObjectOutput, error) {
 	cfg, err := config.LoadDefaultConfig(context.TODO())
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
 
-	client := s3.NewFromConfig(cfg)
+	return uploadFile(ctx, s3.NewFromConfig(cfg), bucket, key, filePath)
+}
+
+func uploadFile(ctx context.Context, client manager.UploadAPIClient, bucket, key, filePath string) (*s3.PutObjectOutput, error) {
+	log.Printf("Uploading file to S3: s3://%s/%s", bucket, key)
 
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -31,6 +39,24 @@ func UploadFileToS3(ctx context.Context, s3Client S3ClientInterface, bucket, key
 	}
 	defer file.Close()
 
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.Size() > multipartUploadThreshold {
+		output, err := manager.NewUploader(client).Upload(ctx, &s3.PutObjectInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(key),
+			Body:              file,
+			ChecksumAlgorithm: s3types.ChecksumAlgorithmCrc32,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload file to S3: %w", err)
+		}
+		log.Printf("File uploaded to S3 in parts: s3://%s/%s", bucket, key)
+		return &s3.PutObjectOutput{ETag: output.ETag, VersionId: output.VersionID}, nil
+	}
+
 	// Calculate MD5 checksum
 	hash := md5.New()
 	if _, err := io.Copy(hash, file); err != nil {
@@ -44,7 +70,7 @@ func UploadFileToS3(ctx context.Context, s3Client S3ClientInterface, bucket, key
 	}
 
 	// Upload the file
-	result, err := client.PutObject(context.TODO(), &s3.PutObjectInput{
+	result, err := client.PutObject(ctx, &s3.PutObjectInput{
 		Bucket:     aws.String(bucket),
 		Key:        aws.String(key),
 		Body:       file,
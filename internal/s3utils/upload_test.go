@@ -0,0 +1,104 @@
+package s3utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uploadStore records single and multipart uploads.
+type uploadStore struct {
+	mu        sync.Mutex
+	putBody   []byte
+	putMD5    string
+	parts     map[int32][]byte
+	completed bool
+}
+
+func (u *uploadStore) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	u.putBody, u.putMD5 = body, aws.ToString(params.ContentMD5)
+	return &s3.PutObjectOutput{ETag: aws.String(`"single"`)}, nil
+}
+
+func (u *uploadStore) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	u.parts = make(map[int32][]byte)
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload")}, nil
+}
+
+func (u *uploadStore) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	u.mu.Lock()
+	u.parts[aws.ToInt32(params.PartNumber)] = body
+	u.mu.Unlock()
+	return &s3.UploadPartOutput{ETag: aws.String(`"part"`)}, nil
+}
+
+func (u *uploadStore) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	u.completed = true
+	return &s3.CompleteMultipartUploadOutput{ETag: aws.String(`"multipart-2"`)}, nil
+}
+
+func (u *uploadStore) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func (u *uploadStore) multipartBody() []byte {
+	numbers := make([]int, 0, len(u.parts))
+	for number := range u.parts {
+		numbers = append(numbers, int(number))
+	}
+	sort.Ints(numbers)
+	var body []byte
+	for _, number := range numbers {
+		body = append(body, u.parts[int32(number)]...)
+	}
+	return body
+}
+
+func TestUploadFile(t *testing.T) {
+	previous := multipartUploadThreshold
+	multipartUploadThreshold = 1 << 20
+	t.Cleanup(func() { multipartUploadThreshold = previous })
+	tempDir := t.TempDir()
+
+	// Small manifests go up in one request with their MD5
+	smallPath := filepath.Join(tempDir, "small.csv")
+	require.NoError(t, os.WriteFile(smallPath, []byte("bucket1,clip.mov\n"), 0644))
+	store := &uploadStore{}
+	output, err := uploadFile(context.Background(), store, "manifests", "small.csv", smallPath)
+	require.NoError(t, err)
+	assert.Equal(t, `"single"`, aws.ToString(output.ETag))
+	assert.Equal(t, "bucket1,clip.mov\n", string(store.putBody))
+	assert.NotEmpty(t, store.putMD5)
+	assert.Nil(t, store.parts)
+
+	// Large ones are uploaded in parts
+	data := bytes.Repeat([]byte("bucket1,project/Assets/clip.mov\n"), 200000)
+	largePath := filepath.Join(tempDir, "large.csv")
+	require.NoError(t, os.WriteFile(largePath, data, 0644))
+	store = &uploadStore{}
+	output, err = uploadFile(context.Background(), store, "manifests", "large.csv", largePath)
+	require.NoError(t, err)
+	assert.Equal(t, `"multipart-2"`, aws.ToString(output.ETag))
+	assert.True(t, store.completed)
+	assert.Greater(t, len(store.parts), 1)
+	assert.Equal(t, data, store.multipartBody())
+	assert.Nil(t, store.putBody)
+}
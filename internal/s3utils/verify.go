@@ -0,0 +1,111 @@
+package s3utils
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Verification methods, from strongest to weakest.
+const (
+	VerifiedSHA256 = "sha256"
+	VerifiedCRC32C = "crc32c"
+	VerifiedCRC32  = "crc32"
+	VerifiedETag   = "etag"
+	VerifiedSize   = "size"
+)
+
+// expectedChecksum picks the strongest full-object checksum S3 has stored for an
+// object. Composite checksums of multipart uploads end in "-<parts>" and can't be
+// compared against a hash of the whole file, and neither can multipart or
+// SSE-KMS ETags, so those fall back to a size check.
+func expectedChecksum(head *s3.HeadObjectOutput) (method, expected string) {
+	fullObject := func(checksum *string) bool {
+		return checksum != nil && *checksum != "" && !strings.Contains(*checksum, "-")
+	}
+
+	switch {
+	case fullObject(head.ChecksumSHA256):
+		return VerifiedSHA256, *head.ChecksumSHA256
+	case fullObject(head.ChecksumCRC32C):
+		return VerifiedCRC32C, *head.ChecksumCRC32C
+	case fullObject(head.ChecksumCRC32):
+		return VerifiedCRC32, *head.ChecksumCRC32
+	}
+
+	etag := strings.Trim(aws.ToString(head.ETag), `"`)
+	if len(etag) == md5.Size*2 && !strings.Contains(etag, "-") && head.ServerSideEncryption != types.ServerSideEncryptionAwsKms {
+		return VerifiedETag, etag
+	}
+	return VerifiedSize, ""
+}
+
+// verifyFile checks a downloaded file against the object's metadata and returns
+// the verification method used.
+func verifyFile(path string, head *s3.HeadObjectOutput) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if head.ContentLength != nil && info.Size() != *head.ContentLength {
+		return VerifiedSize, fmt.Errorf("size mismatch: expected %d bytes, got %d", *head.ContentLength, info.Size())
+	}
+
+	method, expected := expectedChecksum(head)
+	var h hash.Hash
+	switch method {
+	case VerifiedSHA256:
+		h = sha256.New()
+	case VerifiedCRC32C:
+		h = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case VerifiedCRC32:
+		h = crc32.NewIEEE()
+	case VerifiedETag:
+		h = md5.New()
+	default:
+		return method, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return method, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(h, file); err != nil {
+		return method, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// S3 reports checksums base64 encoded and ETags hex encoded
+	actual := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	if method == VerifiedETag {
+		actual = hex.EncodeToString(h.Sum(nil))
+	}
+	if actual != expected {
+		return method, fmt.Errorf("%s mismatch: expected %s, got %s", method, expected, actual)
+	}
+	return method, nil
+}
+
+// quarantineFile moves a file that failed verification out of the project folder.
+func quarantineFile(path, quarantinePath, rel string) (string, error) {
+	target := filepath.Join(quarantinePath, rel)
+	if err := os.MkdirAll(filepath.Dir(target), 0775); err != nil {
+		return "", fmt.Errorf("failed to create quarantine directory: %w", err)
+	}
+	if err := os.Rename(path, target); err != nil {
+		return "", fmt.Errorf("failed to quarantine %s: %w", path, err)
+	}
+	return target, nil
+}
@@ -0,0 +1,106 @@
+package s3utils
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyFile(t *testing.T) {
+	content := []byte("broadcast master")
+	path := filepath.Join(t.TempDir(), "clip.mxf")
+	assert.NoError(t, os.WriteFile(path, content, 0664))
+
+	sha := sha256.Sum256(content)
+	crc := crc32.NewIEEE()
+	crc.Write(content)
+	md5Sum := md5.Sum(content)
+
+	testCases := []struct {
+		name           string
+		head           *s3.HeadObjectOutput
+		expectedMethod string
+		expectError    bool
+	}{
+		{
+			name:           "SHA256 checksum",
+			head:           &s3.HeadObjectOutput{ContentLength: aws.Int64(16), ChecksumSHA256: aws.String(base64.StdEncoding.EncodeToString(sha[:]))},
+			expectedMethod: VerifiedSHA256,
+		},
+		{
+			name:           "CRC32 checksum",
+			head:           &s3.HeadObjectOutput{ContentLength: aws.Int64(16), ChecksumCRC32: aws.String(base64.StdEncoding.EncodeToString(crc.Sum(nil)))},
+			expectedMethod: VerifiedCRC32,
+		},
+		{
+			name:           "Checksum mismatch",
+			head:           &s3.HeadObjectOutput{ContentLength: aws.Int64(16), ChecksumCRC32: aws.String("AAAAAA==")},
+			expectedMethod: VerifiedCRC32,
+			expectError:    true,
+		},
+		{
+			name:           "Single part ETag",
+			head:           &s3.HeadObjectOutput{ContentLength: aws.Int64(16), ETag: aws.String(`"` + hex.EncodeToString(md5Sum[:]) + `"`)},
+			expectedMethod: VerifiedETag,
+		},
+		{
+			name: "Multipart upload falls back to size",
+			head: &s3.HeadObjectOutput{
+				ContentLength: aws.Int64(16),
+				ChecksumCRC32: aws.String("AAAAAA==-3"),
+				ETag:          aws.String(`"9b2cf535f27731c974343645a3985328-3"`),
+			},
+			expectedMethod: VerifiedSize,
+		},
+		{
+			name: "KMS encrypted ETag falls back to size",
+			head: &s3.HeadObjectOutput{
+				ContentLength:        aws.Int64(16),
+				ETag:                 aws.String(`"9b2cf535f27731c974343645a3985328"`),
+				ServerSideEncryption: types.ServerSideEncryptionAwsKms,
+			},
+			expectedMethod: VerifiedSize,
+		},
+		{
+			name:           "Size mismatch",
+			head:           &s3.HeadObjectOutput{ContentLength: aws.Int64(17)},
+			expectedMethod: VerifiedSize,
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			method, err := verifyFile(path, tc.head)
+			assert.Equal(t, tc.expectedMethod, method)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestQuarantineFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "Assets", "clip.mxf")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0775))
+	assert.NoError(t, os.WriteFile(path, []byte("corrupt"), 0664))
+
+	quarantined, err := quarantineFile(path, filepath.Join(dir, "quarantine"), "Project/clip.mxf")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "quarantine", "Project", "clip.mxf"), quarantined)
+	assert.NoFileExists(t, path)
+	assert.FileExists(t, quarantined)
+}
@@ -0,0 +1,19 @@
+package s3utils
+
+import (
+	"fmt"
+	"strings"
+	"syscall"
+)
+
+// setXattr sets an extended attribute in the user namespace. Other namespaces
+// are refused, so that archived metadata can't change security labels.
+func setXattr(path, name, value string) error {
+	if strings.Contains(name, ".") && !strings.HasPrefix(name, "user.") {
+		return fmt.Errorf("only user extended attributes can be restored")
+	}
+	if !strings.HasPrefix(name, "user.") {
+		name = "user." + name
+	}
+	return syscall.Setxattr(path, name, []byte(value), 0)
+}
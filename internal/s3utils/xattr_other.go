@@ -0,0 +1,9 @@
+//go:build !linux
+
+package s3utils
+
+import "errors"
+
+func setXattr(path, name, value string) error {
+	return errors.New("extended attributes are only restored on Linux")
+}
@@ -1,12 +1,19 @@
 package types
 
-import "time"
+import (
+	"fmt"
+	"path"
+	"time"
+)
 
 type RestoreParams struct {
+	RestoreID             string   `json:"restoreId"`
 	AssetBucketList       []string `json:"assetBucketList"`
 	ManifestKey           string   `json:"manifestKey"`
 	ManifestBucket        string   `json:"manifestBucket"`
 	ManifestLocalPath     string   `json:"manifestLocalPath"`
+	AvailableManifestKey  string   `json:"availableManifestKey"`
+	AvailableLocalPath    string   `json:"availableLocalPath"`
 	RoleArn               string   `json:"roleArn"`
 	AWS_ACCESS_KEY_ID     string   `json:"aws_access_key_id"`
 	AWS_SECRET_ACCESS_KEY string   `json:"aws_secret_access_key"`
@@ -23,13 +30,88 @@ type RestoreParams struct {
 	PlutoProjectURL       string   `json:"plutoProjectURL"`
 	FileOwnerUID          int      `json:"file_owner_uid"`
 	FileOwnerGID          int      `json:"file_owner_gid"`
+	ProgressURL           string   `json:"progressUrl"`
+	PollWorkers           int      `json:"pollWorkers"`
+	HeadObjectRate        int      `json:"headObjectRate"`
+	PollInterval          string   `json:"pollInterval"`
+	RestoreEventQueueURL  string   `json:"restoreEventQueueUrl"`
+	QuarantinePath        string   `json:"quarantinePath"`
+	ConflictPolicy        string   `json:"conflictPolicy"`
+	DownloadWorkers       int      `json:"downloadWorkers"`
+	PartConcurrency       int      `json:"partConcurrency"`
+	PartSizeMB            int      `json:"partSizeMB"`
+	BandwidthLimitMB      int      `json:"bandwidthLimitMB"`  // MB/s shared by all downloads
+	BandwidthSchedule     string   `json:"bandwidthSchedule"` // HH:MM-HH:MM when the limit applies
+	TotalSize             int64    `json:"totalSize"`
+	FreeSpaceHeadroomGB   int      `json:"freeSpaceHeadroomGB"`
+	PreserveAttributes    bool     `json:"preserveAttributes"`
+	KeyEscaping           string   `json:"keyEscaping"`
+	Files                 []string `json:"-"` // keys to restore instead of RestorePath, only used by the API
+
+	// Which objects under RestorePath are restored
+	Filter FileFilter `json:"filter"`
 }
 
 type RequestBody struct {
-	ID            int    `json:"id"`
-	Path          string `json:"path"`
-	User          string `json:"user"`
-	RetrievalType string `json:"retrievalType"`
+	ID             int        `json:"id"`
+	Path           string     `json:"path"`
+	User           string     `json:"user"`
+	RetrievalType  string     `json:"retrievalType"`
+	ConflictPolicy string     `json:"conflictPolicy,omitempty"`
+	Filter         FileFilter `json:"filter"`
+	// Asset paths or S3 keys to restore instead of everything under Path
+	Files []string `json:"files,omitempty"`
+}
+
+// ConflictPolicy decides what happens when a restored file already exists locally.
+type ConflictPolicy string
+
+const (
+	// ConflictPolicySkipIfIdentical skips files that match the archived object
+	// and keeps both copies otherwise. It is the default.
+	ConflictPolicySkipIfIdentical ConflictPolicy = "skip-if-identical"
+	ConflictPolicySkip            ConflictPolicy = "skip"
+	ConflictPolicyOverwrite       ConflictPolicy = "overwrite"
+	ConflictPolicyKeepBoth        ConflictPolicy = "keep-both"
+)
+
+func (p ConflictPolicy) Valid() bool {
+	switch p {
+	case ConflictPolicySkipIfIdentical, ConflictPolicySkip, ConflictPolicyOverwrite, ConflictPolicyKeepBoth:
+		return true
+	}
+	return false
+}
+
+// FileFilter selects which objects of a project are restored. Patterns are
+// globs matched against the path relative to the project's Assets folder, where
+// "**" matches any number of folders and a pattern without a "/" matches the
+// file name in any folder. Empty fields don't filter anything.
+type FileFilter struct {
+	Include    []string `json:"include,omitempty"`    // restore only paths matching one of these
+	Exclude    []string `json:"exclude,omitempty"`    // never restore paths matching one of these
+	Extensions []string `json:"extensions,omitempty"` // e.g. "mov" or ".mxf", case insensitive
+	MinSize    int64    `json:"minSize,omitempty"`    // bytes
+	MaxSize    int64    `json:"maxSize,omitempty"`    // bytes
+}
+
+// Validate returns an error describing the first invalid pattern or size.
+func (f FileFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.Include...), f.Exclude...) {
+		if pattern == "" {
+			return fmt.Errorf("empty pattern")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	if f.MinSize < 0 || f.MaxSize < 0 {
+		return fmt.Errorf("sizes can't be negative")
+	}
+	if f.MaxSize > 0 && f.MinSize > f.MaxSize {
+		return fmt.Errorf("minSize %d is larger than maxSize %d", f.MinSize, f.MaxSize)
+	}
+	return nil
 }
 
 type RestoreResponse struct {
@@ -37,12 +119,92 @@ type RestoreResponse struct {
 	JobID     string `json:"jobId"`
 	FileCount int64  `json:"fileCount"`
 	TotalSize int64  `json:"totalSize"`
+	// Requested files that weren't found and won't be restored
+	MissingFiles []string `json:"missingFiles,omitempty"`
+	// Files already on disk that were left out of the restore
+	PresentFileCount int64 `json:"presentFileCount"`
 }
 
 type RestoreStats struct {
-	FileCount    int64
-	TotalSize    int64
-	StandardCost float64
-	BulkCost     float64
-	Timestamp    time.Time
+	FileCount      int64
+	TotalSize      int64
+	StandardCost   float64
+	BulkCost       float64
+	StorageClasses map[string]StorageClassEstimate
+	Timestamp      time.Time
+}
+
+// StorageClassEstimate describes the cost and expected duration of restoring
+// the objects of a single storage class. TotalSize is in GB.
+type StorageClassEstimate struct {
+	FileCount       int64   `json:"numberOfFiles"`
+	TotalSize       float64 `json:"totalSize"`
+	RequiresRestore bool    `json:"requiresRestore"`
+	StandardCost    float64 `json:"standardRetrievalCost"`
+	BulkCost        float64 `json:"bulkRetrievalCost"`
+	StandardTime    string  `json:"standardRetrievalTime"`
+	BulkTime        string  `json:"bulkRetrievalTime"`
+	StandardHours   float64 `json:"standardRetrievalMaxHours"`
+	BulkHours       float64 `json:"bulkRetrievalMaxHours"`
+}
+
+type RestoreState string
+
+const (
+	RestoreStatePending    RestoreState = "pending"
+	RestoreStateJobCreated RestoreState = "job_created"
+	RestoreStateRunning    RestoreState = "running"
+	RestoreStateCompleted  RestoreState = "completed"
+	RestoreStateFailed     RestoreState = "failed"
+	RestoreStateCancelled  RestoreState = "cancelled"
+)
+
+type RestoreRecord struct {
+	ID            string                          `json:"id"`
+	ProjectId     int                             `json:"projectId"`
+	User          string                          `json:"user"`
+	Path          string                          `json:"path"`
+	RetrievalType string                          `json:"retrievalType"`
+	ManifestKey   string                          `json:"manifestKey"`
+	JobName       string                          `json:"jobName,omitempty"`
+	BatchJobID    string                          `json:"batchJobId,omitempty"`
+	State         RestoreState                    `json:"state"`
+	Error         string                          `json:"error,omitempty"`
+	FileCount     int64                           `json:"fileCount"`
+	TotalSize     int64                           `json:"totalSize"`
+	Phase         RestorePhase                    `json:"phase,omitempty"`
+	Progress      map[RestorePhase]ProgressUpdate `json:"progress,omitempty"`
+	CreatedAt     time.Time                       `json:"createdAt"`
+	UpdatedAt     time.Time                       `json:"updatedAt"`
+}
+
+type RestorePhase string
+
+const (
+	RestorePhaseManifestDownloaded RestorePhase = "manifest_downloaded"
+	RestorePhaseBatchJobCreated    RestorePhase = "batch_job_created"
+	RestorePhaseObjectsThawed      RestorePhase = "objects_thawed"
+	RestorePhaseFilesDownloaded    RestorePhase = "files_downloaded"
+	RestorePhaseNotificationSent   RestorePhase = "notification_sent"
+	RestorePhaseFailed             RestorePhase = "failed"
+)
+
+func (p RestorePhase) Valid() bool {
+	switch p {
+	case RestorePhaseManifestDownloaded, RestorePhaseBatchJobCreated, RestorePhaseObjectsThawed,
+		RestorePhaseFilesDownloaded, RestorePhaseNotificationSent, RestorePhaseFailed:
+		return true
+	}
+	return false
+}
+
+// ProgressUpdate is posted by the worker to the API whenever a restore moves
+// through a phase. Done and Total are only set for the counting phases.
+type ProgressUpdate struct {
+	Phase      RestorePhase `json:"phase"`
+	Done       int          `json:"done,omitempty"`
+	Total      int          `json:"total,omitempty"`
+	BatchJobID string       `json:"batchJobId,omitempty"`
+	Message    string       `json:"message,omitempty"`
+	Timestamp  time.Time    `json:"timestamp"`
 }
@@ -11,6 +11,7 @@ import (
 
 	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -41,29 +42,46 @@ func NewJobCreator(namespace string) (*JobCreator, error) {
 	}, nil
 }
 
-func (jc *JobCreator) CreateRestoreJob(params types.RestoreParams) error {
+func (jc *JobCreator) CreateRestoreJob(params types.RestoreParams) (string, error) {
 	jobName := fmt.Sprintf("restore-job-%d-%d", params.ProjectId, time.Now().Unix())
 	log.Printf("Creating restore job: %s", jobName)
 
 	// Check if a job with this name already exists
 	_, err := jc.clientset.BatchV1().Jobs(jc.namespace).Get(context.Background(), jobName, metav1.GetOptions{})
 	if err == nil {
-		return fmt.Errorf("job %s already exists", jobName)
+		return "", fmt.Errorf("job %s already exists", jobName)
 	}
 
 	paramsJSON, err := json.Marshal(params)
 	if err != nil {
-		return fmt.Errorf("failed to marshal restore params: %w", err)
+		return "", fmt.Errorf("failed to marshal restore params: %w", err)
 	}
 
 	ttlSeconds := int32(240) // 3 days in seconds = 259200
+	// A failed worker has already sent its notification, so it isn't retried. Pods
+	// lost to evictions or node failures are replaced and resume from the checkpoint
+	backoffLimit := int32(0)
 
 	job := &batchv1.Job{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: jobName,
+			Labels: map[string]string{
+				"restore-id": params.RestoreID,
+			},
 		},
 		Spec: batchv1.JobSpec{
 			TTLSecondsAfterFinished: &ttlSeconds,
+			BackoffLimit:            &backoffLimit,
+			PodFailurePolicy: &batchv1.PodFailurePolicy{
+				Rules: []batchv1.PodFailurePolicyRule{
+					{
+						Action: batchv1.PodFailurePolicyActionIgnore,
+						OnPodConditions: []batchv1.PodFailurePolicyOnPodConditionsPattern{
+							{Type: corev1.DisruptionTarget, Status: corev1.ConditionTrue},
+						},
+					},
+				},
+			},
 			Template: corev1.PodTemplateSpec{
 				Spec: corev1.PodSpec{
 					Containers: []corev1.Container{
@@ -109,18 +127,38 @@ func (jc *JobCreator) CreateRestoreJob(params types.RestoreParams) error {
 	createdJob, err := jc.clientset.BatchV1().Jobs(jc.namespace).Create(context.Background(), job, metav1.CreateOptions{})
 	if err != nil {
 		log.Printf("Error creating job: %v", err)
-		return fmt.Errorf("failed to create job: %w", err)
+		return "", fmt.Errorf("failed to create job: %w", err)
 	}
 
 	if createdJob == nil {
 		log.Printf("Created job is nil, but no error was returned")
-		return fmt.Errorf("created job is nil")
+		return "", fmt.Errorf("created job is nil")
 	}
 
 	log.Printf("Job created successfully: %s", createdJob.Name)
 	log.Printf("Job UID: %s", createdJob.UID)
 	log.Printf("Job Status: %+v", createdJob.Status)
 
+	return createdJob.Name, nil
+}
+
+// DeleteRestoreJob deletes a restore job and, via foreground propagation, its
+// pods. Deleting a job that no longer exists is not an error.
+func (jc *JobCreator) DeleteRestoreJob(jobName string) error {
+	log.Printf("Deleting restore job: %s", jobName)
+
+	propagation := metav1.DeletePropagationForeground
+	err := jc.clientset.BatchV1().Jobs(jc.namespace).Delete(context.Background(), jobName, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if apierrors.IsNotFound(err) {
+		log.Printf("Job %s not found, nothing to delete", jobName)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete job %s: %w", jobName, err)
+	}
+
 	return nil
 }
 